@@ -0,0 +1,64 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+)
+
+type base64Store struct {
+	store Store
+}
+
+func (bs *base64Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	buf := make([]byte, base64.StdEncoding.EncodedLen(len(value)))
+	base64.StdEncoding.Encode(buf, value)
+	return bs.store.Set(ctx, key, buf, ttl)
+}
+
+func (bs *base64Store) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := bs.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(buf, data)
+	// 非base64编码的数据(如由其它实例写入)当作不存在
+	if err != nil {
+		return nil, ErrIsNil
+	}
+	return buf[:n], nil
+}
+
+func (bs *base64Store) Delete(ctx context.Context, key string) error {
+	return bs.store.Delete(ctx, key)
+}
+
+func (bs *base64Store) Close(ctx context.Context) error {
+	return bs.store.Close(ctx)
+}
+
+// NewBase64Store creates a store which encodes the whole entry (including header)
+// as base64 before saving to the store, it is used for the text-only store.
+// The optional interfaces of store are not supported as the header is encoded,
+// Touch and Exists read and rewrite the whole entry, and SetIfVersion and Add
+// use the lock of process instead of the store.
+func NewBase64Store(store Store) Store {
+	return &base64Store{
+		store: store,
+	}
+}
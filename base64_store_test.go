@@ -0,0 +1,110 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTextStore only accepts the printable ascii value
+type testTextStore struct {
+	Store
+}
+
+func (s *testTextStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	for _, b := range value {
+		if b < 0x20 || b >= utf8.RuneSelf {
+			return errors.New("value is not text")
+		}
+	}
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+func TestBase64Store(t *testing.T) {
+	assert := assert.New(t)
+
+	encryptor, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	bs, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	textStore := &testTextStore{
+		Store: bs,
+	}
+	ctx := context.Background()
+
+	// 未编码的数据无法写入
+	c, err := New(time.Minute, CacheStoreOption(textStore))
+	assert.Nil(err)
+	err = c.SetBytes(ctx, randomString(), []byte("value"))
+	assert.NotNil(err)
+
+	c, err = New(
+		time.Minute,
+		CacheStoreOption(NewBase64Store(textStore)),
+		CacheTransformerOption(
+			NewCompressTransformer(NewS2Compressor(10)),
+			NewEncryptTransformer(encryptor),
+			NewChecksumTransformer(),
+		),
+		CacheVersionOption(),
+	)
+	assert.Nil(err)
+
+	key := randomString()
+	value := []byte(strings.Repeat("Hello World!", 10))
+	err = c.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	buf, err := c.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// touch与exists读取并重写整个数据
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Nil(err)
+	exists, err := c.Exists(ctx, key)
+	assert.Nil(err)
+	assert.True(exists)
+	buf, err = c.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 版本号记录于编码后的数据头中
+	key = randomString()
+	err = c.Set(ctx, key, &testData{Name: "a"})
+	assert.Nil(err)
+	data := testData{}
+	version, err := c.GetWithVersion(ctx, key, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+	err = c.SetIfVersion(ctx, key, &testData{Name: "b"}, version)
+	assert.Nil(err)
+	err = c.SetIfVersion(ctx, key, &testData{Name: "c"}, version)
+	assert.Equal(ErrVersionMismatch, err)
+	err = c.Add(ctx, key, &testData{Name: "d"})
+	assert.Equal(ErrKeyExists, err)
+
+	// 非base64编码的数据当作不存在
+	err = bs.Set(ctx, key, []byte("!"), time.Minute)
+	assert.Nil(err)
+	_, err = c.GetBytes(ctx, key)
+	assert.Equal(ErrIsNil, err)
+}
@@ -16,6 +16,7 @@ package cache
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/allegro/bigcache/v3"
@@ -23,15 +24,45 @@ import (
 
 type bigCacheStore struct {
 	client *bigcache.BigCache
+	locks  *keyMutex
 }
 
 func (bcs *bigCacheStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
 	if key == "" {
 		return ErrKeyIsNil
 	}
+	mu := bcs.locks.get(key)
+	mu.Lock()
+	defer mu.Unlock()
 	return bcs.client.Set(key, value)
 }
 
+func (bcs *bigCacheStore) CompareAndSwap(_ context.Context, key string, version uint64, value []byte, _ time.Duration) (bool, error) {
+	if key == "" {
+		return false, ErrKeyIsNil
+	}
+	mu := bcs.locks.get(key)
+	mu.Lock()
+	defer mu.Unlock()
+	buf, err := bcs.client.Get(key)
+	if err != nil && err != bigcache.ErrEntryNotFound {
+		return false, err
+	}
+	currentVersion := uint64(0)
+	// 已过期的数据视为不存在
+	if len(buf) >= timestampByteSize && getTimeFromBytes(buf).After(time.Now()) {
+		currentVersion = getVersionFromBytes(buf)
+	}
+	if currentVersion != version {
+		return false, nil
+	}
+	err = bcs.client.Set(key, value)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (bcs *bigCacheStore) Get(_ context.Context, key string) ([]byte, error) {
 	if key == "" {
 		return nil, ErrKeyIsNil
@@ -43,6 +74,26 @@ func (bcs *bigCacheStore) Get(_ context.Context, key string) ([]byte, error) {
 	return buf, err
 }
 
+func (bcs *bigCacheStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	// 数据不存在时版本号为0
+	return bcs.CompareAndSwap(ctx, key, 0, value, ttl)
+}
+
+func (bcs *bigCacheStore) Scan(_ context.Context, prefix string, count int) ([]string, error) {
+	keys := make([]string, 0, count)
+	it := bcs.client.Iterator()
+	for len(keys) < count && it.SetNext() {
+		info, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(info.Key(), prefix) {
+			keys = append(keys, info.Key())
+		}
+	}
+	return keys, nil
+}
+
 func (bcs *bigCacheStore) Close(_ context.Context) error {
 	return bcs.client.Close()
 }
@@ -80,5 +131,6 @@ func newBigCacheStore(ttl time.Duration, opt *Option) (Store, error) {
 	}
 	return &bigCacheStore{
 		client: c,
+		locks:  newKeyMutex(conf.Shards),
 	}, nil
 }
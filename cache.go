@@ -23,8 +23,20 @@ import (
 const (
 	// CompressNone compress none
 	CompressNone byte = iota
-	// Compressed compress
+	// Compressed compressed by custom compressor
 	Compressed
+	// CompressSnappy compressed by snappy
+	CompressSnappy
+	// CompressZSTD compressed by zstd
+	CompressZSTD
+	// CompressS2 compressed by s2
+	CompressS2
+	// CompressGzip compressed by gzip
+	CompressGzip
+	// CompressFlate compressed by flate
+	CompressFlate
+	// CompressZSTDDict compressed by zstd with dictionary
+	CompressZSTDDict
 )
 
 type Cache struct {
@@ -32,10 +44,26 @@ type Cache struct {
 	ttlList    []time.Duration
 	stores     []Store
 	compressor Compressor
+	codec      Codec
+	encryptor  *Encryptor
+	signer     *Signer
+	flags      byte
+	// transformers is the transformer chain for writing, and stages is the ids of it
+	transformers []Transformer
+	stages       []byte
+	// stageTransformers is the transformers for reading by stage id
+	stageTransformers map[byte]Transformer
+	chunkSize         int
+	onError           func(key string, err error)
+	locks             *keyMutex
 }
 
 var ErrIsNil = errors.New("Data is nil")
 var ErrKeyIsNil = errors.New("Key is nil")
+var ErrVersionMismatch = errors.New("Version mismatch")
+var ErrKeyExists = errors.New("Key already exists")
+var ErrScanNotSupported = errors.New("Scan is not supported")
+var ErrVersionNotEnabled = errors.New("Version is not enabled")
 
 // New creates a new cache with default ttl
 func New(ttl time.Duration, opts ...CacheOption) (*Cache, error) {
@@ -66,11 +94,80 @@ func New(ttl time.Duration, opts ...CacheOption) (*Cache, error) {
 		}
 	}
 
+	compressor := opt.compressor
+	encryptor := opt.encryptor
+	stageTransformers := map[byte]Transformer{
+		TransformerChecksum: NewChecksumTransformer(),
+	}
+	var stages []byte
+	if len(opt.transformers) != 0 {
+		// 配置了transformer则不可再配置压缩与加密
+		if compressor != nil || encryptor != nil {
+			return nil, ErrTransformerConflict
+		}
+		stages = make([]byte, len(opt.transformers))
+		ids := make(map[byte]bool, len(opt.transformers))
+		for index, t := range opt.transformers {
+			if ids[t.ID()] {
+				return nil, ErrTransformerDuplicated
+			}
+			ids[t.ID()] = true
+			stages[index] = t.ID()
+			stageTransformers[t.ID()] = t
+			// 用于解析旧版本的数据
+			switch tt := t.(type) {
+			case *compressTransformer:
+				compressor = tt.compressor
+			case *encryptTransformer:
+				encryptor = tt.encryptor
+			}
+		}
+	}
+	// 未配置的内置transformer，用于读取由其它配置写入的数据
+	if _, ok := stageTransformers[TransformerCompress]; !ok {
+		stageTransformers[TransformerCompress] = &compressTransformer{
+			compressor: compressor,
+		}
+	}
+	if _, ok := stageTransformers[TransformerEncrypt]; !ok && encryptor != nil {
+		stageTransformers[TransformerEncrypt] = NewEncryptTransformer(encryptor)
+	}
+
+	chunkSize := opt.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	flags := byte(0)
+	// 记录数据的版本号，用于SetIfVersion
+	if opt.versioned {
+		flags |= envelopeFlagVersioned
+	}
+	if opt.checksum {
+		flags |= envelopeFlagChecksum
+	}
+	if opt.encryptor != nil {
+		flags |= envelopeFlagEncrypted
+	}
+	if opt.signer != nil {
+		flags |= envelopeFlagSigned
+	}
+
 	return &Cache{
-		compressor: opt.compressor,
-		keyPrefix:  opt.keyPrefix,
-		ttlList:    ttlList,
-		stores:     stores,
+		compressor:        compressor,
+		codec:             opt.codec,
+		encryptor:         encryptor,
+		signer:            opt.signer,
+		flags:             flags,
+		transformers:      opt.transformers,
+		stages:            stages,
+		stageTransformers: stageTransformers,
+		onError:           opt.onError,
+		chunkSize:         chunkSize,
+		keyPrefix:         opt.keyPrefix,
+		ttlList:           ttlList,
+		stores:            stores,
+		locks:             newKeyMutex(0),
 	}, nil
 }
 
@@ -102,14 +199,22 @@ func (c *Cache) getTTL(index int, ttl ...time.Duration) time.Duration {
 	return c.ttlList[0]
 }
 
-func (c *Cache) getBytes(ctx context.Context, key string) ([]byte, time.Duration, error) {
+// entry is the decoded data of cache
+type entry struct {
+	// legacy is true if the entry is written without envelope
+	legacy bool
+	codec  byte
+	data   []byte
+}
+
+func (c *Cache) get(ctx context.Context, key string) (*entry, time.Duration, error) {
 	key, err := c.getKey(key)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	max := len(c.stores)
-	var data []byte
+	var result *entry
 	var expiredAt time.Time
 	now := time.Now()
 	var ttl time.Duration
@@ -121,13 +226,26 @@ func (c *Cache) getBytes(ctx context.Context, key string) ([]byte, time.Duration
 			return nil, 0, err
 		}
 		// 如果获取到数据
-		if len(buf) >= timestampByteSize {
+		if len(buf) > timestampByteSize {
 			expiredAt = getTimeFromBytes(buf)
 			// 如果已过期，继续查询
 			ttl = expiredAt.Sub(now)
 			if ttl < 0 {
 				continue
 			}
+			e, err := c.decodeEntry(key, buf)
+			// 无法识别的数据当作不存在
+			if err == errEnvelopeUnknown {
+				continue
+			}
+			// 数据已损坏，从store中删除并当作不存在
+			if isCorrupted(err) {
+				c.discard(ctx, s, key, err)
+				continue
+			}
+			if err != nil {
+				return nil, 0, err
+			}
 			// 第一个store的数据已过期，将数据重新设置至store
 			// 一般情况下index为0，由于bigcache可能因为空间不足导致数据清除
 			// 或者二级缓存是redis，其它实例有操作更新
@@ -139,28 +257,220 @@ func (c *Cache) getBytes(ctx context.Context, key string) ([]byte, time.Duration
 				newTTL := c.getTTL(firstIndex, ttl)
 				if newTTL < ttl {
 					ttl = newTTL
-					writeTimeToBytes(time.Now().Add(ttl), data)
+					writeTimeToBytes(time.Now().Add(ttl), buf)
 				}
 				// 设置失败则忽略
 				_ = c.stores[firstIndex].Set(ctx, key, buf, ttl)
 			}
-			data = buf[timestampByteSize:]
+			result = e
 			break
 		}
 	}
-	if len(data) == 0 {
+	if result == nil || len(result.data) == 0 {
 		return nil, 0, ErrIsNil
 	}
+	return result, ttl, nil
+}
+
+// isCorrupted returns true if the entry is corrupted or tampered
+func isCorrupted(err error) bool {
+	return err == ErrChecksumMismatch ||
+		err == ErrSignatureMismatch ||
+		err == ErrDecryptFail
+}
 
-	// 如果有配置压缩
+// decodeEntry decodes the entry bytes of store, it returns
+// errEnvelopeUnknown if the entry can not be decoded by this cache
+func (c *Cache) decodeEntry(key string, buf []byte) (*entry, error) {
+	env, err := parseEnvelope(buf)
+	if err != nil {
+		return nil, err
+	}
+	// 配置了签名，则未签名的数据均视为校验失败
+	if c.signer != nil {
+		if env.signature == nil {
+			return nil, ErrSignatureMismatch
+		}
+		err = c.signer.Verify(env.signature, []byte(key), env.header, env.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 旧版本的数据，根据当前是否配置压缩解析
+	if env.version == envelopeVersionLegacy {
+		data := env.data
+		if c.compressor != nil {
+			data, err = c.compressor.Decode(data)
+			// 无法确定旧数据是否压缩(如未压缩的数据在开启压缩后读取)，
+			// 解压失败则当作不存在
+			if err != nil {
+				return nil, errEnvelopeUnknown
+			}
+		}
+		return &entry{
+			legacy: true,
+			data:   data,
+		}, nil
+	}
+	if env.version == envelopeVersion2 {
+		return c.decodeStages(key, env)
+	}
+	data := env.data
+	if env.flags&envelopeFlagEncrypted != 0 {
+		// 数据已加密但未配置加密，无法解密
+		if c.encryptor == nil {
+			return nil, errEnvelopeUnknown
+		}
+		// 使用key作为附加数据，避免数据被复制至其它key
+		data, err = c.encryptor.Decrypt(data, []byte(key))
+		// 由其它实例或轮换前后的key加密，并非数据损坏
+		if err == ErrEncryptKeyNotFound {
+			return nil, errEnvelopeUnknown
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, ErrDecryptFail
+		}
+	}
 	if c.compressor != nil {
-		buf, err := c.compressor.Decode(data)
+		data, err = c.compressor.Decode(data)
+	} else {
+		// 未配置压缩，则使用内置的解压方式
+		data, err = decompress(data)
+	}
+	// 自定义压缩、未知的压缩类型或无对应的字典，无法解压
+	if isCompressUnknown(err) {
+		return nil, errEnvelopeUnknown
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry{
+		codec: env.codec,
+		data:  data,
+	}, nil
+}
+
+// isCompressUnknown returns true if the compressed data can not be decoded by this cache
+func isCompressUnknown(err error) bool {
+	return err == ErrCompressTypeUnknown || err == ErrZSTDDictNotFound
+}
+
+// decodeStages decodes the data of envelope by the transformers in reverse order
+func (c *Cache) decodeStages(key string, env *envelope) (*entry, error) {
+	data := env.data
+	for index := len(env.stages) - 1; index >= 0; index-- {
+		t, ok := c.stageTransformers[env.stages[index]]
+		// 未配置的transformer，无法解析
+		if !ok {
+			return nil, errEnvelopeUnknown
+		}
+		buf, err := t.Decode(key, data)
+		if isCompressUnknown(err) || err == ErrEncryptKeyNotFound {
+			return nil, errEnvelopeUnknown
+		}
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 		data = buf
 	}
-	return data, ttl, nil
+	return &entry{
+		codec: env.codec,
+		data:  data,
+	}, nil
+}
+
+// newEntry encodes the value to envelope bytes, the expired time should be written later
+func (c *Cache) newEntry(key string, codec byte, value []byte) ([]byte, error) {
+	if len(c.transformers) != 0 {
+		buf := value
+		for _, t := range c.transformers {
+			b, err := t.Encode(key, buf)
+			if err != nil {
+				return nil, err
+			}
+			buf = b
+		}
+		data, offset := newEnvelope(c.flags, codec, c.stages, len(buf))
+		copy(data[offset:], buf)
+		c.sealEntry(key, data)
+		return data, nil
+	}
+	if c.compressor == nil && c.encryptor == nil {
+		data, offset := newEnvelope(c.flags, codec, nil, len(value)+1)
+		data[offset] = CompressNone
+		copy(data[offset+1:], value)
+		c.sealEntry(key, data)
+		return data, nil
+	}
+	var buf []byte
+	if c.compressor != nil {
+		b, err := c.compressor.Encode(value)
+		if err != nil {
+			return nil, err
+		}
+		buf = b
+	} else {
+		buf = make([]byte, len(value)+1)
+		buf[0] = CompressNone
+		copy(buf[1:], value)
+	}
+	// 压缩后再加密
+	if c.encryptor != nil {
+		b, err := c.encryptor.Encrypt(buf, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		buf = b
+	}
+	data, offset := newEnvelope(c.flags, codec, nil, len(buf))
+	copy(data[offset:], buf)
+	c.sealEntry(key, data)
+	return data, nil
+}
+
+// sealEntry writes a new version of data if the versioned flag is set and seals the envelope
+func (c *Cache) sealEntry(key string, data []byte) {
+	if c.flags&envelopeFlagVersioned != 0 {
+		writeEnvelopeVersion(data, newVersion())
+	}
+	sealEnvelope(data, key, c.signer)
+}
+
+// discard deletes the corrupted entry from store and reports the error
+func (c *Cache) discard(ctx context.Context, s Store, key string, err error) {
+	// 删除失败则忽略
+	_ = s.Delete(ctx, key)
+	if c.onError != nil {
+		c.onError(key, err)
+	}
+}
+
+// unmarshalEntry checks the codec of entry and unmarshals it
+func (c *Cache) unmarshalEntry(e *entry, codec Codec, value any) error {
+	// 旧版本数据的codec id在数据中
+	if e.legacy {
+		return unmarshalWithCodec(codec, e.data, value)
+	}
+	if e.codec != codecID(codec) {
+		return ErrCodecMismatch
+	}
+	return unmarshalValue(codec, e.data, value)
+}
+
+// getBytes gets the data and ttl from cache, it returns ErrCodecMismatch
+// for the value set by SetReader, which should be read by GetReader
+func (c *Cache) getBytes(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	e, ttl, err := c.get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.isChunked() {
+		return nil, 0, ErrCodecMismatch
+	}
+	return e.data, ttl, nil
 }
 
 // GetBytes gets the data from cache
@@ -174,23 +484,22 @@ func (c *Cache) GetBytesAndTTL(ctx context.Context, key string) ([]byte, time.Du
 	return c.getBytes(ctx, key)
 }
 
-func (c *Cache) setBytes(ctx context.Context, key string, value []byte, ttls ...time.Duration) error {
+func (c *Cache) set(ctx context.Context, key string, codec byte, value []byte, ttls ...time.Duration) error {
 	key, err := c.getKey(key)
 	if err != nil {
 		return err
 	}
-	// 如果有设置解压
-	if c.compressor != nil {
-		buf, err := c.compressor.Encode(value)
-		if err != nil {
-			return err
-		}
-		value = buf
+	data, err := c.newEntry(key, codec, value)
+	if err != nil {
+		return err
 	}
-	// 增加ttl至value中
-	data := make([]byte, len(value)+timestampByteSize)
-	copy(data[timestampByteSize:], value)
-	for index, s := range c.stores {
+	return c.setToStores(ctx, c.stores, key, data, ttls...)
+}
+
+// setToStores sets the data to stores, the timestamp header will be
+// updated by the ttl of each store
+func (c *Cache) setToStores(ctx context.Context, stores []Store, key string, data []byte, ttls ...time.Duration) error {
+	for index, s := range stores {
 		ttl := c.getTTL(index, ttls...)
 		writeTimeToBytes(time.Now().Add(ttl), data)
 		err := s.Set(ctx, key, data, ttl)
@@ -203,16 +512,16 @@ func (c *Cache) setBytes(ctx context.Context, key string, value []byte, ttls ...
 
 // SetBytes sets the data to cache
 func (c *Cache) SetBytes(ctx context.Context, key string, value []byte, ttl ...time.Duration) error {
-	return c.setBytes(ctx, key, value, ttl...)
+	return c.set(ctx, key, CodecDefault, value, ttl...)
 }
 
 // Set marshals the value to bytes and sets to cache
 func (c *Cache) Set(ctx context.Context, key string, value any, ttl ...time.Duration) error {
-	entry, err := marshal(value)
+	buf, err := marshalValue(c.codec, value)
 	if err != nil {
 		return err
 	}
-	return c.setBytes(ctx, key, entry, ttl...)
+	return c.set(ctx, key, codecID(c.codec), buf, ttl...)
 }
 
 func Get[T any](ctx context.Context, c *Cache, key string) (*T, error) {
@@ -226,28 +535,39 @@ func Get[T any](ctx context.Context, c *Cache, key string) (*T, error) {
 
 // Get gets the value from cache and unmarshals it
 func (c *Cache) Get(ctx context.Context, key string, value any) error {
-	data, _, err := c.getBytes(ctx, key)
+	e, _, err := c.get(ctx, key)
 	if err != nil {
 		return err
 	}
-	return unmarshal(data, value)
+	return c.unmarshalEntry(e, c.codec, value)
 }
 
 // GetAndTTL gets the value from cache and unmarshals it, and returns the ttl of value
 func (c *Cache) GetAndTTL(ctx context.Context, key string, value any) (time.Duration, error) {
-	data, ttl, err := c.getBytes(ctx, key)
+	e, ttl, err := c.get(ctx, key)
 	if err != nil {
 		return 0, err
 	}
-	err = unmarshal(data, value)
+	err = c.unmarshalEntry(e, c.codec, value)
 	if err != nil {
 		return 0, err
 	}
 	return ttl, nil
 }
 
-// Delete deletes all the data from all stores
+// Delete deletes all the data from all stores,
+// the chunks of value set by SetReader are also deleted
 func (c *Cache) Delete(ctx context.Context, key string) error {
+	m := c.findManifest(ctx, key)
+	err := c.delete(ctx, key)
+	// 先删除manifest再删除chunk，避免读取到不完整的数据
+	if m != nil {
+		c.deleteChunks(ctx, key, m)
+	}
+	return err
+}
+
+func (c *Cache) delete(ctx context.Context, key string) error {
 	key, err := c.getKey(key)
 	if err != nil {
 		return err
@@ -261,3 +581,345 @@ func (c *Cache) Delete(ctx context.Context, key string) error {
 	}
 	return err
 }
+
+func (c *Cache) touch(ctx context.Context, s Store, key string, ttl time.Duration) error {
+	expiredAt := time.Now().Add(ttl)
+	// store支持直接更新过期时间
+	if toucher, ok := s.(Toucher); ok {
+		return toucher.Touch(ctx, key, expiredAt, ttl)
+	}
+	buf, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	// 数据不存在或已过期，不再延长有效期
+	if len(buf) < timestampByteSize || getTimeFromBytes(buf).Before(time.Now()) {
+		return ErrIsNil
+	}
+	// 复制数据，避免修改store中的数据
+	data := make([]byte, len(buf))
+	copy(data, buf)
+	writeTimeToBytes(expiredAt, data)
+	return s.Set(ctx, key, data, ttl)
+}
+
+// Touch updates the expired time of data in all stores without rewriting the value,
+// it returns ErrIsNil if the data is not exists in any store. The chunks of value
+// set by SetReader are touched before the manifest, it returns ErrChunkMissing
+// if any chunk is not exists.
+func (c *Cache) Touch(ctx context.Context, key string, ttl ...time.Duration) error {
+	m := c.findManifest(ctx, key)
+	if m != nil {
+		for index := 0; index < m.Count; index++ {
+			err := c.touchKey(ctx, m.chunkKey(key, index), ttl...)
+			if err == ErrIsNil {
+				return ErrChunkMissing
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.touchKey(ctx, key, ttl...)
+}
+
+// touchKey updates the expired time of key in all stores
+func (c *Cache) touchKey(ctx context.Context, key string, ttl ...time.Duration) error {
+	key, err := c.getKey(key)
+	if err != nil {
+		return err
+	}
+	found := false
+	for index, s := range c.stores {
+		e := c.touch(ctx, s, key, c.getTTL(index, ttl...))
+		if e == ErrIsNil {
+			continue
+		}
+		if e != nil {
+			return e
+		}
+		found = true
+	}
+	if !found {
+		return ErrIsNil
+	}
+	return nil
+}
+
+func (c *Cache) peek(ctx context.Context, s Store, keys []string) ([]time.Time, error) {
+	// store支持仅获取数据头
+	if peeker, ok := s.(Peeker); ok {
+		return peeker.Peek(ctx, keys...)
+	}
+	result := make([]time.Time, len(keys))
+	for index, key := range keys {
+		buf, err := s.Get(ctx, key)
+		if err == ErrIsNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) >= timestampByteSize {
+			result[index] = getTimeFromBytes(buf)
+		}
+	}
+	return result, nil
+}
+
+// MultiExists checks whether the keys are exists and not expired,
+// only the header of data is inspected
+func (c *Cache) MultiExists(ctx context.Context, keys ...string) ([]bool, error) {
+	result := make([]bool, len(keys))
+	// 仍需查询的key及其对应的索引
+	pendingKeys := make([]string, 0, len(keys))
+	pendingIndexes := make([]int, 0, len(keys))
+	for index, key := range keys {
+		key, err := c.getKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pendingKeys = append(pendingKeys, key)
+		pendingIndexes = append(pendingIndexes, index)
+	}
+	max := len(c.stores)
+	now := time.Now()
+	for index, s := range c.stores {
+		if len(pendingKeys) == 0 {
+			break
+		}
+		expiredAtList, err := c.peek(ctx, s, pendingKeys)
+		if err != nil {
+			// 最后一个store出错则直接返回
+			if index == max-1 {
+				return nil, err
+			}
+			continue
+		}
+		nextKeys := pendingKeys[:0]
+		nextIndexes := pendingIndexes[:0]
+		for i, expiredAt := range expiredAtList {
+			if expiredAt.After(now) {
+				result[pendingIndexes[i]] = true
+				continue
+			}
+			nextKeys = append(nextKeys, pendingKeys[i])
+			nextIndexes = append(nextIndexes, pendingIndexes[i])
+		}
+		pendingKeys = nextKeys
+		pendingIndexes = nextIndexes
+	}
+	return result, nil
+}
+
+// Exists checks whether the key is exists and not expired,
+// only the header of data is inspected
+func (c *Cache) Exists(ctx context.Context, key string) (bool, error) {
+	result, err := c.MultiExists(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return result[0], nil
+}
+
+// GetWithVersion gets the value from the last store and unmarshals it,
+// the version should be used for SetIfVersion. It returns ErrVersionNotEnabled
+// if the cache is not created with CacheVersionOption.
+func (c *Cache) GetWithVersion(ctx context.Context, key string, value any) (uint64, error) {
+	if c.flags&envelopeFlagVersioned == 0 {
+		return 0, ErrVersionNotEnabled
+	}
+	key, err := c.getKey(key)
+	if err != nil {
+		return 0, err
+	}
+	// 最后一个store的数据为准
+	buf, err := c.stores[len(c.stores)-1].Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) <= timestampByteSize || getTimeFromBytes(buf).Before(time.Now()) {
+		return 0, ErrIsNil
+	}
+	version := getVersionFromBytes(buf)
+	e, err := c.decodeEntry(key, buf)
+	if err == errEnvelopeUnknown {
+		return 0, ErrIsNil
+	}
+	if isCorrupted(err) {
+		c.discard(ctx, c.stores[len(c.stores)-1], key, err)
+		return 0, ErrIsNil
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = c.unmarshalEntry(e, c.codec, value)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (c *Cache) compareAndSwap(ctx context.Context, s Store, key string, version uint64, data []byte, ttl time.Duration) (bool, error) {
+	if cas, ok := s.(CompareAndSwapper); ok {
+		return cas.CompareAndSwap(ctx, key, version, data, ttl)
+	}
+	// store不支持时，使用进程内的锁
+	mu := c.locks.get(key)
+	mu.Lock()
+	defer mu.Unlock()
+	buf, err := s.Get(ctx, key)
+	if err != nil && err != ErrIsNil {
+		return false, err
+	}
+	currentVersion := uint64(0)
+	if len(buf) >= timestampByteSize && getTimeFromBytes(buf).After(time.Now()) {
+		currentVersion = getVersionFromBytes(buf)
+	}
+	if currentVersion != version {
+		return false, nil
+	}
+	err = s.Set(ctx, key, data, ttl)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetIfVersion marshals the value and sets to cache only if the version of data
+// in the last store is matched, the version 0 means the data should not exist.
+// It returns ErrVersionMismatch if the data has been modified, and ErrVersionNotEnabled
+// if the cache is not created with CacheVersionOption.
+func (c *Cache) SetIfVersion(ctx context.Context, key string, value any, version uint64, ttl ...time.Duration) error {
+	if c.flags&envelopeFlagVersioned == 0 {
+		return ErrVersionNotEnabled
+	}
+	key, err := c.getKey(key)
+	if err != nil {
+		return err
+	}
+	buf, err := marshalValue(c.codec, value)
+	if err != nil {
+		return err
+	}
+	data, err := c.newEntry(key, codecID(c.codec), buf)
+	if err != nil {
+		return err
+	}
+	// 由最后一个store判断版本是否一致
+	last := len(c.stores) - 1
+	d := c.getTTL(last, ttl...)
+	writeTimeToBytes(time.Now().Add(d), data)
+	success, err := c.compareAndSwap(ctx, c.stores[last], key, version, data, d)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrVersionMismatch
+	}
+	// 成功后再更新其它的store
+	return c.setToStores(ctx, c.stores[:last], key, data, ttl...)
+}
+
+func (c *Cache) add(ctx context.Context, s Store, key string, data []byte, ttl time.Duration) (bool, error) {
+	if adder, ok := s.(Adder); ok {
+		return adder.Add(ctx, key, data, ttl)
+	}
+	// 数据不存在时版本号为0
+	return c.compareAndSwap(ctx, s, key, 0, data, ttl)
+}
+
+// Add marshals the value and sets to cache only if the key is not exists,
+// the last store decides whether the key is exists.
+// It returns ErrKeyExists if the key is exists.
+func (c *Cache) Add(ctx context.Context, key string, value any, ttl ...time.Duration) error {
+	key, err := c.getKey(key)
+	if err != nil {
+		return err
+	}
+	buf, err := marshalValue(c.codec, value)
+	if err != nil {
+		return err
+	}
+	data, err := c.newEntry(key, codecID(c.codec), buf)
+	if err != nil {
+		return err
+	}
+	last := len(c.stores) - 1
+	d := c.getTTL(last, ttl...)
+	writeTimeToBytes(time.Now().Add(d), data)
+	success, err := c.add(ctx, c.stores[last], key, data, d)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrKeyExists
+	}
+	// 成功后再更新其它的store
+	return c.setToStores(ctx, c.stores[:last], key, data, ttl...)
+}
+
+// Sample returns at most count values of cache, the keys are scanned from
+// the last store which supports Scanner, and the values are read from it
+// without setting to other stores. The values can be used to build
+// zstd dictionary by BuildZSTDDict.
+func (c *Cache) Sample(ctx context.Context, count int) ([][]byte, error) {
+	var store Store
+	var scanner Scanner
+	for index := len(c.stores) - 1; index >= 0; index-- {
+		if s, ok := c.stores[index].(Scanner); ok {
+			store = c.stores[index]
+			scanner = s
+			break
+		}
+	}
+	if scanner == nil {
+		return nil, ErrScanNotSupported
+	}
+	keys, err := scanner.Scan(ctx, c.keyPrefix, count)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		// 分块数据的chunk仅为数据的片段，不作为样本
+		if isChunkKey(key) {
+			continue
+		}
+		buf, err := store.Get(ctx, key)
+		if err == ErrIsNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) <= timestampByteSize || getTimeFromBytes(buf).Before(now) {
+			continue
+		}
+		e, err := c.decodeEntry(key, buf)
+		// 无法解析或已损坏的数据忽略
+		if err == errEnvelopeUnknown || isCorrupted(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 分块数据的manifest不作为样本
+		if e.isChunked() || len(e.data) == 0 {
+			continue
+		}
+		values = append(values, e.data)
+	}
+	return values, nil
+}
+
+// CompressorStats returns the stats of compressor,
+// it returns false if the compressor does not support stats
+func (c *Cache) CompressorStats() (CompressorStats, bool) {
+	sc, ok := c.compressor.(StatsCompressor)
+	if !ok {
+		return CompressorStats{}, false
+	}
+	return sc.Stats(), true
+}
@@ -16,6 +16,7 @@ package cache
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -155,10 +156,10 @@ func TestCacheMultiStore(t *testing.T) {
 	assert.Nil(err)
 	buf, err := s1.Get(context.Background(), key)
 	assert.Nil(err)
-	assert.Equal(value, buf[timestampByteSize:])
+	assert.Equal(value, buf[envelopeHeaderSize+1:])
 	buf, err = s2.Get(context.Background(), key)
 	assert.Nil(err)
-	assert.Equal(value, buf[timestampByteSize:])
+	assert.Equal(value, buf[envelopeHeaderSize+1:])
 
 	// 一级缓存清除
 	err = s1.Delete(context.Background(), key)
@@ -228,6 +229,240 @@ func TestGetAndTTL(t *testing.T) {
 	assert.Equal(data, result)
 }
 
+func TestCacheTouch(t *testing.T) {
+	assert := assert.New(t)
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	client := newClient()
+	s2 := NewRedisStore(client)
+
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(s2),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key := randomString()
+	err = c.Touch(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+
+	value := []byte("value")
+	err = c.SetBytes(context.Background(), key, value, time.Second)
+	assert.Nil(err)
+
+	err = c.Touch(context.Background(), key, time.Hour)
+	assert.Nil(err)
+
+	result, ttl, err := c.GetBytesAndTTL(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, result)
+	assert.Greater(ttl, 59*time.Minute)
+
+	// 二级缓存的ttl与数据中的过期时间均已更新
+	buf, err := s2.Get(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf[envelopeHeaderSize+1:])
+	assert.Greater(time.Until(getTimeFromBytes(buf)), 59*time.Minute)
+	redisTTL, err := client.TTL(context.Background(), key).Result()
+	assert.Nil(err)
+	assert.Greater(redisTTL, 59*time.Minute)
+
+	err = c.Delete(context.Background(), key)
+	assert.Nil(err)
+}
+
+func TestCacheExists(t *testing.T) {
+	assert := assert.New(t)
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	s2 := NewRedisStore(newClient())
+
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(s2),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key1 := randomString()
+	key2 := randomString()
+	key3 := randomString()
+	err = c.SetBytes(context.Background(), key1, []byte("value"))
+	assert.Nil(err)
+	err = c.SetBytes(context.Background(), key2, []byte("value"))
+	assert.Nil(err)
+	// 一级缓存清除，从二级缓存中判断
+	err = s1.Delete(context.Background(), key2)
+	assert.Nil(err)
+
+	exists, err := c.Exists(context.Background(), key1)
+	assert.Nil(err)
+	assert.True(exists)
+
+	result, err := c.MultiExists(context.Background(), key1, key2, key3)
+	assert.Nil(err)
+	assert.Equal([]bool{true, true, false}, result)
+
+	_, err = c.Exists(context.Background(), "")
+	assert.Equal(ErrKeyIsNil, err)
+
+	err = c.Delete(context.Background(), key1)
+	assert.Nil(err)
+	err = s2.Delete(context.Background(), key2)
+	assert.Nil(err)
+}
+
+func TestCacheSetIfVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	// 未开启版本号
+	c, err := New(time.Minute)
+	assert.Nil(err)
+	_, err = c.GetWithVersion(context.Background(), randomString(), &testData{})
+	assert.Equal(ErrVersionNotEnabled, err)
+	err = c.SetIfVersion(context.Background(), randomString(), &testData{}, 0)
+	assert.Equal(ErrVersionNotEnabled, err)
+
+	tests := []struct {
+		opts []CacheOption
+	}{
+		// 仅使用bigcache
+		{
+			opts: []CacheOption{
+				CacheVersionOption(),
+			},
+		},
+		// 二级缓存为redis
+		{
+			opts: []CacheOption{
+				CacheStoreOption(s1),
+				CacheSecondaryStoreOption(NewRedisStore(newClient())),
+				CacheSnappyOption(10),
+				CacheVersionOption(),
+			},
+		},
+	}
+	for _, tt := range tests {
+		c, err := New(time.Minute, tt.opts...)
+		assert.Nil(err)
+		key := randomString()
+
+		data := testData{}
+		_, err = c.GetWithVersion(context.Background(), key, &data)
+		assert.Equal(ErrIsNil, err)
+
+		// 版本号0表示数据不存在时才设置
+		err = c.SetIfVersion(context.Background(), key, &testData{Name: "a"}, 0)
+		assert.Nil(err)
+		err = c.SetIfVersion(context.Background(), key, &testData{Name: "b"}, 0)
+		assert.Equal(ErrVersionMismatch, err)
+
+		version, err := c.GetWithVersion(context.Background(), key, &data)
+		assert.Nil(err)
+		assert.NotEqual(uint64(0), version)
+		assert.Equal("a", data.Name)
+
+		// touch不影响版本号
+		err = c.Touch(context.Background(), key)
+		assert.Nil(err)
+		err = c.SetIfVersion(context.Background(), key, &testData{Name: "c"}, version)
+		assert.Nil(err)
+		err = c.SetIfVersion(context.Background(), key, &testData{Name: "d"}, version)
+		assert.Equal(ErrVersionMismatch, err)
+
+		err = c.Get(context.Background(), key, &data)
+		assert.Nil(err)
+		assert.Equal("c", data.Name)
+
+		// 数据被修改后再改回原值，版本号仍不一致
+		version, err = c.GetWithVersion(context.Background(), key, &data)
+		assert.Nil(err)
+		err = c.Set(context.Background(), key, &testData{Name: "x"})
+		assert.Nil(err)
+		err = c.Set(context.Background(), key, &testData{Name: "c"})
+		assert.Nil(err)
+		err = c.SetIfVersion(context.Background(), key, &testData{Name: "e"}, version)
+		assert.Equal(ErrVersionMismatch, err)
+
+		// 并发更新
+		count := 20
+		wg := sync.WaitGroup{}
+		for i := 0; i < count; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					values := make([]int, 0)
+					version, err := c.GetWithVersion(context.Background(), key+"count", &values)
+					if err != nil && err != ErrIsNil {
+						panic(err)
+					}
+					values = append(values, len(values))
+					err = c.SetIfVersion(context.Background(), key+"count", values, version)
+					if err == ErrVersionMismatch {
+						continue
+					}
+					if err != nil {
+						panic(err)
+					}
+					return
+				}
+			}()
+		}
+		wg.Wait()
+		values := make([]int, 0)
+		err = c.Get(context.Background(), key+"count", &values)
+		assert.Nil(err)
+		assert.Equal(count, len(values))
+
+		_ = c.Delete(context.Background(), key)
+		_ = c.Delete(context.Background(), key+"count")
+	}
+}
+
+func TestCacheAdd(t *testing.T) {
+	assert := assert.New(t)
+
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	s2 := NewRedisStore(newClient())
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(s2),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key := randomString()
+	err = c.Add(context.Background(), key, &testData{Name: "a"})
+	assert.Nil(err)
+	err = c.Add(context.Background(), key, &testData{Name: "b"})
+	assert.Equal(ErrKeyExists, err)
+
+	data := testData{}
+	err = c.Get(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	// 一级缓存存在其它数据时，由二级缓存决定
+	err = s2.Delete(context.Background(), key)
+	assert.Nil(err)
+	err = c.Add(context.Background(), key, &testData{Name: "c"})
+	assert.Nil(err)
+	err = c.Get(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("c", data.Name)
+
+	err = c.Delete(context.Background(), key)
+	assert.Nil(err)
+}
+
 func BenchmarkBigcache(b *testing.B) {
 	c, _ := New(time.Minute, CacheHardMaxCacheSizeOption(1))
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,276 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChunkSize  = 256 * 1024
+	chunkKeySeparator = ":chunk:"
+	// randomIDSize is the bytes of random id
+	randomIDSize = 8
+)
+
+// codecChunkManifest is the reserved codec id of chunk manifest,
+// it should not be used by other codec
+const codecChunkManifest byte = 0xff
+
+var ErrChunkMissing = errors.New("Chunk is missing")
+
+// chunkManifest is the manifest of chunked value, it is saved to the key
+// after all chunks are saved, so the partial writes are never visible
+type chunkManifest struct {
+	// ID is the random id of each write, it is a part of chunk key
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+func (m *chunkManifest) chunkKey(key string, index int) string {
+	return key + chunkKeySeparator + m.ID + ":" + strconv.Itoa(index)
+}
+
+// isChunkKey returns true if the key is the chunk key of chunked value,
+// the format is key:chunk:id:index
+func isChunkKey(key string) bool {
+	index := strings.LastIndex(key, chunkKeySeparator)
+	if index < 0 {
+		return false
+	}
+	fields := strings.Split(key[index+len(chunkKeySeparator):], ":")
+	if len(fields) != 2 || len(fields[0]) != randomIDSize*2 {
+		return false
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil {
+		return false
+	}
+	_, err := strconv.Atoi(fields[1])
+	return err == nil
+}
+
+// newRandomID returns a random hex string, it is used as the id of chunk and the token of lock
+func newRandomID() (string, error) {
+	buf := make([]byte, randomIDSize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// isChunked returns true if the entry is the manifest of chunked value
+func (e *entry) isChunked() bool {
+	return !e.legacy && e.codec == codecChunkManifest
+}
+
+// getManifest gets the manifest of entry, it returns nil if the value is not chunked
+func (c *Cache) getManifest(e *entry) (*chunkManifest, error) {
+	if !e.isChunked() {
+		return nil, nil
+	}
+	m := &chunkManifest{}
+	err := json.Unmarshal(e.data, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// isManifestHeader returns true if the header is the envelope of chunk manifest
+func isManifestHeader(header []byte) bool {
+	if len(header) < envelopeHeaderSize || header[timestampByteSize] != envelopeMagic {
+		return false
+	}
+	version := header[timestampByteSize+1]
+	if version != envelopeVersion1 && version != envelopeVersion2 {
+		return false
+	}
+	return header[timestampByteSize+3] == codecChunkManifest
+}
+
+// peekHeader gets the header of key from store, the whole data
+// is returned if the store does not support HeaderPeeker
+func (c *Cache) peekHeader(ctx context.Context, s Store, key string) ([]byte, error) {
+	if peeker, ok := s.(HeaderPeeker); ok {
+		return peeker.PeekHeader(ctx, key, envelopeHeaderSize)
+	}
+	return s.Get(ctx, key)
+}
+
+// findManifest gets the manifest of key from stores, it returns nil if the
+// value is not chunked or can not be read. Only the header is read if the
+// value is not chunked, and the manifest is not set to other stores.
+func (c *Cache) findManifest(ctx context.Context, key string) *chunkManifest {
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	for _, s := range c.stores {
+		buf, err := c.peekHeader(ctx, s, key)
+		if err != nil || !isManifestHeader(buf) || getTimeFromBytes(buf).Before(now) {
+			continue
+		}
+		// 仅获取了数据头，再获取完整的数据
+		if len(buf) <= envelopeHeaderSize {
+			buf, err = s.Get(ctx, key)
+			if err != nil || len(buf) <= timestampByteSize {
+				continue
+			}
+		}
+		e, err := c.decodeEntry(key, buf)
+		if err != nil {
+			continue
+		}
+		m, err := c.getManifest(e)
+		if err == nil && m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+func (c *Cache) deleteChunks(ctx context.Context, key string, m *chunkManifest) {
+	for index := 0; index < m.Count; index++ {
+		// 删除失败则忽略，数据过期后会被清除
+		_ = c.delete(ctx, m.chunkKey(key, index))
+	}
+}
+
+// SetReader reads the data from reader and splits it into chunks, each chunk is
+// compressed and saved as a chunk key, and then the manifest is saved to the key.
+// The chunks of previous value will be deleted after the manifest is saved.
+func (c *Cache) SetReader(ctx context.Context, key string, r io.Reader, ttl ...time.Duration) error {
+	if key == "" {
+		return ErrKeyIsNil
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	m := &chunkManifest{
+		ID: id,
+	}
+	buf := make([]byte, c.chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n != 0 {
+			e := c.set(ctx, m.chunkKey(key, m.Count), CodecDefault, buf[:n], ttl...)
+			if e != nil {
+				c.deleteChunks(ctx, key, m)
+				return e
+			}
+			m.Count++
+			m.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		// 读取失败，清除已写入的数据
+		if err != nil {
+			c.deleteChunks(ctx, key, m)
+			return err
+		}
+	}
+	// 获取原有的manifest，用于清除原有的chunk
+	prev := c.findManifest(ctx, key)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// 所有chunk写入后才写入manifest
+	err = c.set(ctx, key, codecChunkManifest, data, ttl...)
+	if err != nil {
+		c.deleteChunks(ctx, key, m)
+		return err
+	}
+	if prev != nil && prev.ID != m.ID {
+		c.deleteChunks(ctx, key, prev)
+	}
+	return nil
+}
+
+// GetReader returns the reader of value, the chunks are read one by one.
+// The value set by SetBytes can also be read by it.
+func (c *Cache) GetReader(ctx context.Context, key string) (io.ReadCloser, error) {
+	e, _, err := c.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.getManifest(e)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return io.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	return &chunkReader{
+		ctx:      ctx,
+		cache:    c,
+		key:      key,
+		manifest: m,
+	}, nil
+}
+
+type chunkReader struct {
+	ctx      context.Context
+	cache    *Cache
+	key      string
+	manifest *chunkManifest
+	index    int
+	buf      []byte
+	closed   bool
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if cr.closed {
+		return 0, io.ErrClosedPipe
+	}
+	for len(cr.buf) == 0 {
+		if cr.index >= cr.manifest.Count {
+			return 0, io.EOF
+		}
+		e, _, err := cr.cache.get(cr.ctx, cr.manifest.chunkKey(cr.key, cr.index))
+		// chunk已过期或被新的数据清除
+		if err == ErrIsNil {
+			return 0, ErrChunkMissing
+		}
+		if err != nil {
+			return 0, err
+		}
+		cr.buf = e.data
+		cr.index++
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) Close() error {
+	cr.closed = true
+	cr.buf = nil
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type errReader struct {
+	data []byte
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("read fail")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestCacheReader(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(
+		time.Minute,
+		CacheKeyPrefixOption("chunk:"),
+		CacheChunkSizeOption(100),
+		CacheS2Option(10),
+		CacheSecondaryStoreOption(NewRedisStore(newClient())),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	key := randomString()
+	data := []byte(strings.Repeat("Hello World!", 100))
+	err = c.SetReader(ctx, key, bytes.NewReader(data))
+	assert.Nil(err)
+
+	r, err := c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err := io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(data, buf)
+	assert.Nil(r.Close())
+
+	// 写入新的数据后，原有的chunk被清除
+	e, _, err := c.get(ctx, key)
+	assert.Nil(err)
+	prev, err := c.getManifest(e)
+	assert.Nil(err)
+	assert.Equal(12, prev.Count)
+	assert.Equal(int64(len(data)), prev.Size)
+
+	newData := []byte(strings.Repeat("New data!", 20))
+	err = c.SetReader(ctx, key, bytes.NewReader(newData))
+	assert.Nil(err)
+	_, err = c.GetBytes(ctx, prev.chunkKey(key, 0))
+	assert.Equal(ErrIsNil, err)
+	r, err = c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err = io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(newData, buf)
+
+	// 读取失败时不影响原有的数据
+	err = c.SetReader(ctx, key, &errReader{
+		data: data[:250],
+	})
+	assert.Equal("read fail", err.Error())
+	r, err = c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err = io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(newData, buf)
+
+	// chunk缺失
+	e, _, err = c.get(ctx, key)
+	assert.Nil(err)
+	m, err := c.getManifest(e)
+	assert.Nil(err)
+	r, err = c.GetReader(ctx, key)
+	assert.Nil(err)
+	err = c.Delete(ctx, m.chunkKey(key, 1))
+	assert.Nil(err)
+	_, err = io.ReadAll(r)
+	assert.Equal(ErrChunkMissing, err)
+
+	// 空数据
+	key = randomString()
+	err = c.SetReader(ctx, key, bytes.NewReader(nil))
+	assert.Nil(err)
+	r, err = c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err = io.ReadAll(r)
+	assert.Nil(err)
+	assert.Empty(buf)
+
+	// 非chunk的数据
+	key = randomString()
+	err = c.SetBytes(ctx, key, data)
+	assert.Nil(err)
+	r, err = c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err = io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(data, buf)
+
+	_, err = c.GetReader(ctx, randomString())
+	assert.Equal(ErrIsNil, err)
+	err = c.SetReader(ctx, "", bytes.NewReader(data))
+	assert.Equal(ErrKeyIsNil, err)
+}
+
+func TestCacheReaderWithCacheAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(
+		time.Minute,
+		CacheChunkSizeOption(100),
+		CacheSecondaryStoreOption(NewRedisStore(newClient())),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	key := randomString()
+	data := []byte(strings.Repeat("Hello World!", 30))
+	err = c.SetReader(ctx, key, bytes.NewReader(data), 50*time.Millisecond)
+	assert.Nil(err)
+
+	// manifest不可作为数据读取
+	_, err = c.GetBytes(ctx, key)
+	assert.Equal(ErrCodecMismatch, err)
+	_, _, err = c.GetBytesAndTTL(ctx, key)
+	assert.Equal(ErrCodecMismatch, err)
+	value := make([]byte, 0)
+	err = c.Get(ctx, key, &value)
+	assert.Equal(ErrCodecMismatch, err)
+
+	// touch同时延长chunk的有效期
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Nil(err)
+	time.Sleep(100 * time.Millisecond)
+	r, err := c.GetReader(ctx, key)
+	assert.Nil(err)
+	buf, err := io.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal(data, buf)
+
+	// 删除时同时删除chunk
+	m := c.findManifest(ctx, key)
+	assert.NotNil(m)
+	err = c.Delete(ctx, key)
+	assert.Nil(err)
+	for index := 0; index < m.Count; index++ {
+		_, err = c.GetBytes(ctx, m.chunkKey(key, index))
+		assert.Equal(ErrIsNil, err)
+	}
+
+	// chunk缺失时touch失败
+	err = c.SetReader(ctx, key, bytes.NewReader(data))
+	assert.Nil(err)
+	m = c.findManifest(ctx, key)
+	assert.NotNil(m)
+	err = c.delete(ctx, m.chunkKey(key, 2))
+	assert.Nil(err)
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Equal(ErrChunkMissing, err)
+}
+
+// testCountStore counts the Get of redis store
+type testCountStore struct {
+	*redisStore
+	gets int
+}
+
+func (s *testCountStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.gets++
+	return s.redisStore.Get(ctx, key)
+}
+
+func TestCacheTouchDeleteHeaderOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	s2 := &testCountStore{
+		redisStore: NewRedisStore(newClient()).(*redisStore),
+	}
+	c, err := New(
+		time.Minute,
+		CacheChunkSizeOption(100),
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(s2),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	// 非分块的数据仅获取数据头
+	key := randomString()
+	err = c.SetBytes(ctx, key, []byte("value"))
+	assert.Nil(err)
+	err = s1.Delete(ctx, key)
+	assert.Nil(err)
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Nil(err)
+	// 一级缓存中已不存在，bigcache删除时返回出错
+	_ = c.Delete(ctx, key)
+	assert.Equal(0, s2.gets)
+
+	// 分块的数据获取manifest，但不写入一级缓存
+	data := []byte(strings.Repeat("Hello World!", 30))
+	err = c.SetReader(ctx, key, bytes.NewReader(data))
+	assert.Nil(err)
+	err = s1.Delete(ctx, key)
+	assert.Nil(err)
+	s2.gets = 0
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Nil(err)
+	assert.Equal(1, s2.gets)
+	_, err = s1.Get(ctx, key)
+	assert.Equal(ErrIsNil, err)
+	m := c.findManifest(ctx, key)
+	assert.NotNil(m)
+	_ = c.Delete(ctx, key)
+	_, err = s2.redisStore.Get(ctx, key)
+	assert.Equal(ErrIsNil, err)
+	for index := 0; index < m.Count; index++ {
+		_, err = s2.redisStore.Get(ctx, m.chunkKey(key, index))
+		assert.Equal(ErrIsNil, err)
+	}
+}
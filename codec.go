@@ -0,0 +1,176 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"errors"
+)
+
+const (
+	// CodecDefault the id of default marshal and unmarshal, it uses
+	// Marshaler/Unmarshaler of value or json, custom codec should not use it
+	CodecDefault byte = iota
+	// CodecGob the id of gob codec
+	CodecGob
+	// CodecRaw the id of raw codec
+	CodecRaw
+)
+
+var ErrCodecMismatch = errors.New("Codec mismatch")
+
+// Codec is the interface that marshals and unmarshals the value of cache
+type Codec interface {
+	Marshaler
+	Unmarshaler
+	// ID returns the identifier of codec, it is recorded
+	// with the data to detect mixed-codec data on read,
+	// 0xff is reserved for the manifest of chunked value
+	ID() byte
+}
+
+// codecID returns the id of codec, CodecDefault will be returned if codec is nil
+func codecID(codec Codec) byte {
+	if codec == nil {
+		return CodecDefault
+	}
+	return codec.ID()
+}
+
+// marshalValue marshals the value with codec, the value is marshaled by default if codec is nil
+func marshalValue(codec Codec, value any) ([]byte, error) {
+	if codec == nil {
+		return marshal(value)
+	}
+	return codec.Marshal(value)
+}
+
+// unmarshalValue unmarshals the data with codec, the data is unmarshaled by default if codec is nil
+func unmarshalValue(codec Codec, data []byte, value any) error {
+	if codec == nil {
+		return unmarshal(data, value)
+	}
+	return codec.Unmarshal(data, value)
+}
+
+// marshalWithCodec marshals the value with codec and prepends the id of codec,
+// the value is marshaled by default without codec id if codec is nil
+func marshalWithCodec(codec Codec, value any) ([]byte, error) {
+	if codec == nil {
+		return marshal(value)
+	}
+	buf, err := codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(buf)+1)
+	data[0] = codec.ID()
+	copy(data[1:], buf)
+	return data, nil
+}
+
+// unmarshalWithCodec checks the codec id of data and unmarshals it with codec,
+// the data is unmarshaled by default if codec is nil
+func unmarshalWithCodec(codec Codec, data []byte, value any) error {
+	if codec == nil {
+		return unmarshal(data, value)
+	}
+	// 数据非此codec生成
+	if len(data) == 0 || data[0] != codec.ID() {
+		return ErrCodecMismatch
+	}
+	return codec.Unmarshal(data[1:], value)
+}
+
+type gobCodec struct{}
+
+// Marshal marshals the value with gob
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal unmarshals the data with gob
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ID returns the id of gob codec
+func (gobCodec) ID() byte {
+	return CodecGob
+}
+
+// NewGobCodec creates a codec using encoding/gob,
+// the interface values should be registered by gob.Register
+func NewGobCodec() Codec {
+	return gobCodec{}
+}
+
+type rawCodec struct{}
+
+// Marshal returns the bytes of []byte, string and encoding.BinaryMarshaler,
+// other values will be marshaled by default
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch data := v.(type) {
+	case []byte:
+		return data, nil
+	case *[]byte:
+		return *data, nil
+	case string:
+		return []byte(data), nil
+	case *string:
+		return []byte(*data), nil
+	case encoding.BinaryMarshaler:
+		return data.MarshalBinary()
+	default:
+		return marshal(v)
+	}
+}
+
+// Unmarshal sets the data to *[]byte, *string and encoding.BinaryUnmarshaler,
+// other values will be unmarshaled by default
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch value := v.(type) {
+	case *[]byte:
+		// 复制数据，避免引用缓存中的数据
+		*value = append([]byte(nil), data...)
+		return nil
+	case *string:
+		*value = string(data)
+		return nil
+	case encoding.BinaryUnmarshaler:
+		return value.UnmarshalBinary(data)
+	default:
+		return unmarshal(data, v)
+	}
+}
+
+// ID returns the id of raw codec
+func (rawCodec) ID() byte {
+	return CodecRaw
+}
+
+// NewRawCodec creates a codec which passes through []byte, string and
+// encoding.BinaryMarshaler values without json encoding,
+// other values are marshaled by default
+func NewRawCodec() Codec {
+	return rawCodec{}
+}
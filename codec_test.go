@@ -0,0 +1,215 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testJSONCodec struct {
+	id byte
+}
+
+func (tc *testJSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (tc *testJSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (tc *testJSONCodec) ID() byte {
+	return tc.id
+}
+
+func TestMarshalWithCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := &testJSONCodec{id: 100}
+	buf, err := marshalWithCodec(codec, &testData{Name: "a"})
+	assert.Nil(err)
+	assert.Equal(append([]byte{100}, `{"name":"a"}`...), buf)
+
+	data := testData{}
+	err = unmarshalWithCodec(codec, buf, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	// 数据非此codec生成
+	err = unmarshalWithCodec(&testJSONCodec{id: 101}, buf, &data)
+	assert.Equal(ErrCodecMismatch, err)
+	err = unmarshalWithCodec(codec, []byte(`{"name":"a"}`), &data)
+	assert.Equal(ErrCodecMismatch, err)
+
+	// 未指定codec
+	buf, err = marshalWithCodec(nil, &testData{Name: "b"})
+	assert.Nil(err)
+	assert.Equal([]byte(`{"name":"b"}`), buf)
+	err = unmarshalWithCodec(nil, buf, &data)
+	assert.Nil(err)
+	assert.Equal("b", data.Name)
+}
+
+func TestGobCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := NewGobCodec()
+	assert.Equal(CodecGob, codec.ID())
+	buf, err := codec.Marshal(&testData{Name: "a"})
+	assert.Nil(err)
+	data := testData{}
+	err = codec.Unmarshal(buf, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+}
+
+func TestRawCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	codec := NewRawCodec()
+	assert.Equal(CodecRaw, codec.ID())
+
+	// bytes
+	value := []byte("abc")
+	buf, err := codec.Marshal(value)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+	buf, err = codec.Marshal(&value)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+	result := []byte{}
+	err = codec.Unmarshal(buf, &result)
+	assert.Nil(err)
+	assert.Equal(value, result)
+
+	// string
+	buf, err = codec.Marshal("abc")
+	assert.Nil(err)
+	assert.Equal([]byte("abc"), buf)
+	str := ""
+	err = codec.Unmarshal(buf, &str)
+	assert.Nil(err)
+	assert.Equal("abc", str)
+
+	// binary marshaler
+	u, _ := url.Parse("https://github.com/vicanso/go-cache")
+	buf, err = codec.Marshal(u)
+	assert.Nil(err)
+	assert.Equal([]byte("https://github.com/vicanso/go-cache"), buf)
+	resultURL := url.URL{}
+	err = codec.Unmarshal(buf, &resultURL)
+	assert.Nil(err)
+	assert.Equal(u.String(), resultURL.String())
+
+	// 其它类型
+	buf, err = codec.Marshal(&testData{Name: "a"})
+	assert.Nil(err)
+	assert.Equal([]byte(`{"name":"a"}`), buf)
+	data := testData{}
+	err = codec.Unmarshal(buf, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+}
+
+func TestCacheCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	store := NewRedisStore(newClient())
+	c1, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCodecOption(&testJSONCodec{id: 100}),
+	)
+	assert.Nil(err)
+	c2, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCodecOption(&testJSONCodec{id: 101}),
+	)
+	assert.Nil(err)
+	defer c1.Close(context.Background())
+
+	key := randomString()
+	err = c1.Set(context.Background(), key, &testData{Name: "a"})
+	assert.Nil(err)
+	data := testData{}
+	err = c1.Get(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	err = c2.Get(context.Background(), key, &data)
+	assert.Equal(ErrCodecMismatch, err)
+
+	err = c1.Delete(context.Background(), key)
+	assert.Nil(err)
+
+	// 字符串不再做json编码
+	c3, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCodecOption(NewRawCodec()),
+	)
+	assert.Nil(err)
+	err = c3.Set(context.Background(), key, "abc")
+	assert.Nil(err)
+	buf, err := c3.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal([]byte("abc"), buf)
+	// codec记录在数据头中
+	buf, err = store.Get(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(CodecRaw, buf[timestampByteSize+3])
+	str := ""
+	err = c3.Get(context.Background(), key, &str)
+	assert.Nil(err)
+	assert.Equal("abc", str)
+
+	err = c3.Delete(context.Background(), key)
+	assert.Nil(err)
+}
+
+func TestRedisCacheCodec(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c, RedisCacheCodecOption(&testJSONCodec{id: 100}))
+	key := randomString()
+
+	err := srv.SetStruct(context.Background(), key, &testData{Name: "a"})
+	assert.Nil(err)
+	buf, err := srv.Get(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(byte(100), buf[0])
+	data := testData{}
+	err = srv.GetStruct(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	err = srv.SetStructWithTTL(context.Background(), key, &testData{Name: "b"}, time.Minute)
+	assert.Nil(err)
+	ttl, err := srv.GetStructAndTTL(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("b", data.Name)
+	assert.Greater(ttl, 59*time.Second)
+
+	_, err = srv.Del(context.Background(), key)
+	assert.Nil(err)
+}
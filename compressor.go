@@ -15,10 +15,23 @@
 package cache
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
 	"github.com/golang/snappy"
+	"github.com/klauspost/compress"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
 )
 
+// ErrCompressTypeUnknown the compress type of data is not supported
+var ErrCompressTypeUnknown = errors.New("Compress type unknown")
+
 // Compressor is the interface that support
 // encode and decode function for compression.
 //
@@ -31,15 +44,78 @@ type Compressor interface {
 	// Decode decodes the data
 	Decode(data []byte) ([]byte, error)
 }
+
+// StatsCompressor is the optional interface of compressor,
+// it reports the decisions of compression
+type StatsCompressor interface {
+	// Stats returns the stats of compressor
+	Stats() CompressorStats
+}
+
+// CompressorStats is the stats of compressor
+type CompressorStats struct {
+	// Compressed is the count of compressed data
+	Compressed uint64
+	// SizeSkipped is the count of data which is not compressed for the size is too small
+	SizeSkipped uint64
+	// EstimateSkipped is the count of data which is not compressed for the estimate is too low
+	EstimateSkipped uint64
+	// RatioSkipped is the count of data which is not compressed for the compression ratio is not met
+	RatioSkipped uint64
+	// InputBytes is the size of input data
+	InputBytes uint64
+	// OutputBytes is the size of output data(without compress type)
+	OutputBytes uint64
+}
+
+// compressEstimateSampleSize is the max size of data for estimating compressibility
+const compressEstimateSampleSize = 4 * 1024
+
 type CompressorOption struct {
+	// Type compress type recorded with the compressed data,
+	// Compressed will be used if it is not set
+	Type byte
 	// MinCompressLength min compress length
 	MinCompressLength int
+	// MinRatio is the min ratio of saved size, e.g. 0.1 means that the compressed data
+	// should be at least 10% smaller, otherwise the data will not be compressed.
+	// The data will not be compressed if the compressed data is not smaller
+	MinRatio float64
+	// MinEstimate is the min compressibility estimate of data, the sample of data
+	// is estimated before compression if it is greater than 0, and the data will
+	// not be compressed if the estimate is less than it. 0.1 is recommended
+	MinEstimate float64
 	// Encode encode function
 	Encode func(data []byte) ([]byte, error)
 	// Decode decode function
 	Decode func(data []byte) ([]byte, error)
 }
 
+// CompressorAdaptiveOption sets the adaptive option of built-in compressor
+type CompressorAdaptiveOption func(opt *CompressorOption)
+
+// CompressorMinRatioOption sets the min ratio of saved size for compressor
+func CompressorMinRatioOption(minRatio float64) CompressorAdaptiveOption {
+	return func(opt *CompressorOption) {
+		opt.MinRatio = minRatio
+	}
+}
+
+// CompressorMinEstimateOption sets the min compressibility estimate for compressor
+func CompressorMinEstimateOption(minEstimate float64) CompressorAdaptiveOption {
+	return func(opt *CompressorOption) {
+		opt.MinEstimate = minEstimate
+	}
+}
+
+// newAdaptiveCompressor creates a compressor with the adaptive options
+func newAdaptiveCompressor(opt CompressorOption, opts ...CompressorAdaptiveOption) Compressor {
+	for _, fn := range opts {
+		fn(&opt)
+	}
+	return NewCompressor(opt)
+}
+
 func snappyEncode(data []byte) ([]byte, error) {
 	dst := []byte{}
 	dst = snappy.Encode(dst, data)
@@ -51,62 +127,273 @@ func snappyDecode(data []byte) ([]byte, error) {
 	return snappy.Decode(dst, data)
 }
 
-func zstdEncode(data []byte, level int) ([]byte, error) {
-	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+// zstdEncoder is the shared encoder of the same level,
+// EncodeAll of zstd.Encoder is safe for concurrent use
+type zstdEncoder struct {
+	level   int
+	once    sync.Once
+	encoder *zstd.Encoder
+	err     error
+}
+
+func (ze *zstdEncoder) encode(data []byte) ([]byte, error) {
+	// 创建encoder的成本较高，因此仅创建一次
+	ze.once.Do(func() {
+		ze.encoder, ze.err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(ze.level)))
+	})
+	if ze.err != nil {
+		return nil, ze.err
+	}
+	return ze.encoder.EncodeAll(data, make([]byte, 0, len(data))), nil
+}
+
+var zstdDecoder struct {
+	once    sync.Once
+	decoder *zstd.Decoder
+	err     error
+}
+
+// zstdDecode decodes the data with the shared decoder,
+// DecodeAll of zstd.Decoder is safe for concurrent use
+func zstdDecode(data []byte) ([]byte, error) {
+	zstdDecoder.once.Do(func() {
+		zstdDecoder.decoder, zstdDecoder.err = zstd.NewReader(nil)
+	})
+	if zstdDecoder.err != nil {
+		return nil, zstdDecoder.err
+	}
+	return zstdDecoder.decoder.DecodeAll(data, nil)
+}
+
+// compressDecoders are the decoders of built-in compress types,
+// they are used to decode the data compressed by other algorithm
+var compressDecoders = map[byte]func(data []byte) ([]byte, error){
+	CompressSnappy: snappyDecode,
+	CompressZSTD:   zstdDecode,
+	CompressS2:     s2Decode,
+	CompressGzip:   gzipDecode,
+	CompressFlate:  flateDecode,
+}
+
+// decompress decodes the data by the compress type(first byte) with built-in decoders
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] == CompressNone {
+		return data[1:], nil
+	}
+	fn, ok := compressDecoders[data[0]]
+	if !ok {
+		return nil, ErrCompressTypeUnknown
+	}
+	return fn(data[1:])
+}
+
+func s2Encode(data []byte) ([]byte, error) {
+	return s2.Encode(nil, data), nil
+}
+
+func s2Decode(data []byte) ([]byte, error) {
+	return s2.Decode(nil, data)
+}
+
+// gzipEncoder pools the gzip writers of the same level
+type gzipEncoder struct {
+	level   int
+	writers sync.Pool
+}
+
+func (ge *gzipEncoder) encode(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, _ := ge.writers.Get().(*gzip.Writer)
+	if w == nil {
+		nw, err := gzip.NewWriterLevel(buf, ge.level)
+		if err != nil {
+			return nil, err
+		}
+		w = nw
+	} else {
+		w.Reset(buf)
+	}
+	defer ge.writers.Put(w)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
 	if err != nil {
 		return nil, err
 	}
-	data = encoder.EncodeAll(data, make([]byte, 0, len(data)))
-	return data, nil
+	return buf.Bytes(), nil
 }
 
-func zstdDecode(data []byte) ([]byte, error) {
-	decoder, err := zstd.NewReader(nil)
+var gzipReaders sync.Pool
+
+func gzipDecode(data []byte) ([]byte, error) {
+	r, _ := gzipReaders.Get().(*gzip.Reader)
+	if r == nil {
+		nr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = nr
+	} else {
+		err := r.Reset(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer gzipReaders.Put(r)
+	return io.ReadAll(r)
+}
+
+// flateEncoder pools the flate writers of the same level
+type flateEncoder struct {
+	level   int
+	writers sync.Pool
+}
+
+func (fe *flateEncoder) encode(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, _ := fe.writers.Get().(*flate.Writer)
+	if w == nil {
+		nw, err := flate.NewWriter(buf, fe.level)
+		if err != nil {
+			return nil, err
+		}
+		w = nw
+	} else {
+		w.Reset(buf)
+	}
+	defer fe.writers.Put(w)
+	_, err := w.Write(data)
 	if err != nil {
 		return nil, err
 	}
-	return decoder.DecodeAll(data, nil)
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var flateReaders sync.Pool
+
+func flateDecode(data []byte) ([]byte, error) {
+	r, _ := flateReaders.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	} else {
+		err := r.(flate.Resetter).Reset(bytes.NewReader(data), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer flateReaders.Put(r)
+	return io.ReadAll(r)
 }
 
 type compressor struct {
+	compressType      byte
 	minCompressLength int
+	minRatio          float64
+	minEstimate       float64
 	encode            func(data []byte) ([]byte, error)
 	decode            func(data []byte) ([]byte, error)
+
+	compressed      atomic.Uint64
+	sizeSkipped     atomic.Uint64
+	estimateSkipped atomic.Uint64
+	ratioSkipped    atomic.Uint64
+	inputBytes      atomic.Uint64
+	outputBytes     atomic.Uint64
 }
 
-func (c *compressor) Encode(data []byte) ([]byte, error) {
+// compress compresses the data, it returns nil if the data should not be compressed
+func (c *compressor) compress(data []byte) ([]byte, error) {
 	size := len(data)
+	if !c.Match(size) {
+		c.sizeSkipped.Add(1)
+		return nil, nil
+	}
+	// 先对部分数据评估是否可压缩，避免无效的压缩
+	if c.minEstimate > 0 {
+		sample := data
+		if len(sample) > compressEstimateSampleSize {
+			sample = sample[:compressEstimateSampleSize]
+		}
+		if compress.Estimate(sample) < c.minEstimate {
+			c.estimateSkipped.Add(1)
+			return nil, nil
+		}
+	}
+	buf, err := c.encode(data)
+	if err != nil {
+		return nil, err
+	}
+	// 压缩后的数据未达到压缩率，如图片等已压缩的数据
+	if float64(len(buf)) >= float64(size)*(1-c.minRatio) {
+		c.ratioSkipped.Add(1)
+		return nil, nil
+	}
+	c.compressed.Add(1)
+	return buf, nil
+}
+
+func (c *compressor) Encode(data []byte) ([]byte, error) {
 	// 不做压缩
 	compressType := CompressNone
-	if c.Match(size) {
-		compressType = Compressed
-		buf, err := c.encode(data)
-		if err != nil {
-			return nil, err
-		}
+	buf, err := c.compress(data)
+	if err != nil {
+		return nil, err
+	}
+	c.inputBytes.Add(uint64(len(data)))
+	if buf != nil {
+		compressType = c.compressType
 		data = buf
-		size = len(data)
 	}
-	newData := make([]byte, size+1)
+	c.outputBytes.Add(uint64(len(data)))
+	newData := make([]byte, len(data)+1)
 	newData[0] = compressType
 	copy(newData[1:], data)
 	return newData, nil
 }
 
+// Stats returns the stats of compressor
+func (c *compressor) Stats() CompressorStats {
+	return CompressorStats{
+		Compressed:      c.compressed.Load(),
+		SizeSkipped:     c.sizeSkipped.Load(),
+		EstimateSkipped: c.estimateSkipped.Load(),
+		RatioSkipped:    c.ratioSkipped.Load(),
+		InputBytes:      c.inputBytes.Load(),
+		OutputBytes:     c.outputBytes.Load(),
+	}
+}
+
 func (c *compressor) Decode(data []byte) ([]byte, error) {
 	if len(data) == 0 {
 		return nil, nil
 	}
 	compressType := data[0]
-	data = data[1:]
-	if compressType != CompressNone {
-		buf, err := c.decode(data)
-		if err != nil {
-			return nil, err
+	switch compressType {
+	case CompressNone:
+		return data[1:], nil
+	// 旧版本或自定义压缩的数据均为Compressed，无法确定其压缩算法，
+	// 内置算法解压失败时视为未知的压缩类型
+	case Compressed:
+		buf, err := c.decode(data[1:])
+		if err != nil && c.compressType != Compressed {
+			return nil, ErrCompressTypeUnknown
 		}
-		data = buf
+		return buf, err
+	case c.compressType:
+		return c.decode(data[1:])
+	default:
+		// 由其它算法压缩的数据
+		return decompress(data)
 	}
-	return data, nil
 }
 
 func (c *compressor) Match(size int) bool {
@@ -115,29 +402,76 @@ func (c *compressor) Match(size int) bool {
 
 // NewCompressor creates a new compressor
 func NewCompressor(opt CompressorOption) Compressor {
+	compressType := opt.Type
+	if compressType == CompressNone {
+		compressType = Compressed
+	}
 	return &compressor{
+		compressType:      compressType,
 		minCompressLength: opt.MinCompressLength,
+		minRatio:          opt.MinRatio,
+		minEstimate:       opt.MinEstimate,
 		encode:            opt.Encode,
 		decode:            opt.Decode,
 	}
 }
 
-// NewZSTDCompressor creates a zstd compressor
-func NewZSTDCompressor(minCompressLength, level int) Compressor {
-	return NewCompressor(CompressorOption{
+// NewZSTDCompressor creates a zstd compressor, the encoder is shared by the compressor
+func NewZSTDCompressor(minCompressLength, level int, opts ...CompressorAdaptiveOption) Compressor {
+	encoder := &zstdEncoder{
+		level: level,
+	}
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressZSTD,
 		MinCompressLength: minCompressLength,
-		Encode: func(data []byte) ([]byte, error) {
-			return zstdEncode(data, level)
-		},
-		Decode: zstdDecode,
-	})
+		Encode:            encoder.encode,
+		Decode:            zstdDecode,
+	}, opts...)
 }
 
 // NewSnappyCompressor creates a snappy compressor
-func NewSnappyCompressor(minCompressLength int) Compressor {
-	return NewCompressor(CompressorOption{
+func NewSnappyCompressor(minCompressLength int, opts ...CompressorAdaptiveOption) Compressor {
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressSnappy,
 		MinCompressLength: minCompressLength,
 		Encode:            snappyEncode,
 		Decode:            snappyDecode,
-	})
+	}, opts...)
+}
+
+// NewS2Compressor creates a s2 compressor, s2 is an extension of snappy
+// with better compression and speed
+func NewS2Compressor(minCompressLength int, opts ...CompressorAdaptiveOption) Compressor {
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressS2,
+		MinCompressLength: minCompressLength,
+		Encode:            s2Encode,
+		Decode:            s2Decode,
+	}, opts...)
+}
+
+// NewGzipCompressor creates a gzip compressor, the writers are pooled by the compressor
+func NewGzipCompressor(minCompressLength, level int, opts ...CompressorAdaptiveOption) Compressor {
+	encoder := &gzipEncoder{
+		level: level,
+	}
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressGzip,
+		MinCompressLength: minCompressLength,
+		Encode:            encoder.encode,
+		Decode:            gzipDecode,
+	}, opts...)
+}
+
+// NewFlateCompressor creates a flate(deflate) compressor, the writers are pooled by the compressor
+func NewFlateCompressor(minCompressLength, level int, opts ...CompressorAdaptiveOption) Compressor {
+	encoder := &flateEncoder{
+		level: level,
+	}
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressFlate,
+		MinCompressLength: minCompressLength,
+		Encode:            encoder.encode,
+		Decode:            flateDecode,
+	}, opts...)
 }
@@ -15,8 +15,15 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,7 +45,7 @@ func TestCompressor(t *testing.T) {
 		{
 			Compressor:   NewSnappyCompressor(50),
 			Data:         []byte(longString),
-			CompressData: []byte("\x01:<{\"name\":\"Snappy n\a\x004速度很快\"}"),
+			CompressData: []byte("\x02:<{\"name\":\"Snappy n\a\x004速度很快\"}"),
 		},
 		{
 			Compressor:   NewZSTDCompressor(50, 1),
@@ -48,7 +55,7 @@ func TestCompressor(t *testing.T) {
 		{
 			Compressor:   NewZSTDCompressor(50, 1),
 			Data:         []byte(longString),
-			CompressData: []byte("\x01(\xb5/\xfd\x04\x005\x01\x00\xe4\x01{\"name\":\"Snappy 速度很快\"}\x01T\x10\x03\x19\x14\x056\xcfS"),
+			CompressData: []byte("\x03(\xb5/\xfd\x04\x005\x01\x00\xe4\x01{\"name\":\"Snappy 速度很快\"}\x01T\x10\x03\x19\x14\x056\xcfS"),
 		},
 	}
 
@@ -62,3 +69,284 @@ func TestCompressor(t *testing.T) {
 		assert.Equal(tt.Data, result)
 	}
 }
+
+func TestBuiltinCompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte(strings.Repeat(`{"name":"compress"}`, 10))
+	tests := []struct {
+		compressor   Compressor
+		compressType byte
+	}{
+		{
+			compressor:   NewSnappyCompressor(10),
+			compressType: CompressSnappy,
+		},
+		{
+			compressor:   NewZSTDCompressor(10, 1),
+			compressType: CompressZSTD,
+		},
+		{
+			compressor:   NewS2Compressor(10),
+			compressType: CompressS2,
+		},
+		{
+			compressor:   NewGzipCompressor(10, 6),
+			compressType: CompressGzip,
+		},
+		{
+			compressor:   NewFlateCompressor(10, 6),
+			compressType: CompressFlate,
+		},
+	}
+	for _, tt := range tests {
+		// 多次执行，确认复用的writer与reader正常
+		for i := 0; i < 3; i++ {
+			buf, err := tt.compressor.Encode(data)
+			assert.Nil(err)
+			assert.Equal(tt.compressType, buf[0])
+			assert.Less(len(buf), len(data))
+
+			result, err := tt.compressor.Decode(buf)
+			assert.Nil(err)
+			assert.Equal(data, result)
+
+			result, err = decompress(buf)
+			assert.Nil(err)
+			assert.Equal(data, result)
+
+			// 其它算法压缩的数据也可解压
+			for _, item := range tests {
+				result, err = item.compressor.Decode(buf)
+				assert.Nil(err)
+				assert.Equal(data, result)
+			}
+		}
+	}
+
+	// 旧版本的数据为Compressed
+	buf, err := snappyEncode(data)
+	assert.Nil(err)
+	result, err := NewSnappyCompressor(10).Decode(append([]byte{Compressed}, buf...))
+	assert.Nil(err)
+	assert.Equal(data, result)
+
+	_, err = decompress([]byte{Compressed, 1})
+	assert.Equal(ErrCompressTypeUnknown, err)
+
+	// 旧版本的数据由其它算法压缩，无法解压
+	_, err = NewZSTDCompressor(10, 1).Decode(append([]byte{Compressed}, buf...))
+	assert.Equal(ErrCompressTypeUnknown, err)
+}
+
+func TestCacheSwitchCompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	gzipCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheGzipOption(10, 6),
+	)
+	assert.Nil(err)
+	s2Cache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheS2Option(10),
+	)
+	assert.Nil(err)
+
+	key := randomString()
+	value := []byte(strings.Repeat("Hello World!", 10))
+	err = gzipCache.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+
+	// 切换压缩算法后，原有的数据仍可读取
+	buf, err := s2Cache.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 旧版本的数据未记录压缩算法，切换后无法解压当作不存在
+	key = randomString()
+	err = store.Set(context.Background(), key, newLegacyEntry(NewCompressor(CompressorOption{
+		MinCompressLength: 10,
+		Encode:            snappyEncode,
+		Decode:            snappyDecode,
+	}), value), time.Minute)
+	assert.Nil(err)
+	_, err = gzipCache.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+
+	// 同一实例中的v1数据(自定义压缩)同样当作不存在
+	customCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCompressorOption(NewCompressor(CompressorOption{
+			MinCompressLength: 10,
+			Encode:            snappyEncode,
+			Decode:            snappyDecode,
+		})),
+	)
+	assert.Nil(err)
+	key = randomString()
+	err = customCache.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	_, err = gzipCache.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+}
+
+func TestAdaptiveCompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	random := make([]byte, 2048)
+	_, err := rand.Read(random)
+	assert.Nil(err)
+	text := []byte(strings.Repeat("Hello World!", 100))
+
+	// 随机数据压缩后无法变小，不压缩
+	c := NewS2Compressor(10)
+	buf, err := c.Encode(random)
+	assert.Nil(err)
+	assert.Equal(CompressNone, buf[0])
+	assert.Equal(random, buf[1:])
+	buf, err = c.Encode(text)
+	assert.Nil(err)
+	assert.Equal(CompressS2, buf[0])
+	buf, err = c.Encode([]byte("Hello"))
+	assert.Nil(err)
+	assert.Equal(CompressNone, buf[0])
+
+	stats := c.(StatsCompressor).Stats()
+	assert.Equal(uint64(1), stats.Compressed)
+	assert.Equal(uint64(1), stats.SizeSkipped)
+	assert.Equal(uint64(1), stats.RatioSkipped)
+	assert.Equal(uint64(0), stats.EstimateSkipped)
+	assert.Equal(uint64(len(random)+len(text)+5), stats.InputBytes)
+	assert.Less(stats.OutputBytes, stats.InputBytes)
+
+	// 压缩率不满足
+	c = NewZSTDCompressor(10, 1, CompressorMinRatioOption(0.99))
+	buf, err = c.Encode(text)
+	assert.Nil(err)
+	assert.Equal(CompressNone, buf[0])
+	assert.Equal(uint64(1), c.(StatsCompressor).Stats().RatioSkipped)
+
+	// 评估为不可压缩，不执行压缩
+	c = NewGzipCompressor(10, 6, CompressorMinEstimateOption(0.1))
+	buf, err = c.Encode(random)
+	assert.Nil(err)
+	assert.Equal(CompressNone, buf[0])
+	buf, err = c.Encode(text)
+	assert.Nil(err)
+	assert.Equal(CompressGzip, buf[0])
+	stats = c.(StatsCompressor).Stats()
+	assert.Equal(uint64(1), stats.EstimateSkipped)
+	assert.Equal(uint64(1), stats.Compressed)
+
+	cache, err := New(time.Minute, CacheS2Option(10))
+	assert.Nil(err)
+	err = cache.SetBytes(context.Background(), randomString(), random)
+	assert.Nil(err)
+	stats, ok := cache.CompressorStats()
+	assert.True(ok)
+	assert.Equal(uint64(1), stats.RatioSkipped)
+
+	cache, err = New(time.Minute)
+	assert.Nil(err)
+	_, ok = cache.CompressorStats()
+	assert.False(ok)
+}
+
+func TestZSTDCompressorConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewZSTDCompressor(10, 2)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := bytes.Repeat([]byte{byte(i)}, 1024)
+			buf, err := c.Encode(data)
+			assert.Nil(err)
+			result, err := c.Decode(buf)
+			assert.Nil(err)
+			assert.Equal(data, result)
+		}(i)
+	}
+	wg.Wait()
+
+	// 非法的压缩级别
+	_, err := NewZSTDCompressor(10, 100).Encode(bytes.Repeat([]byte("a"), 100))
+	assert.NotNil(err)
+}
+
+var benchmarkZSTDData = bytes.Repeat([]byte(`{"name":"Snappy Snappy Snappy Snappy Snappy 速度很快","id":1234567890}`), 200)
+
+// 每次创建encoder与decoder
+func zstdEncodeWithNewWriter(data []byte, level int) ([]byte, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(data, make([]byte, 0, len(data))), nil
+}
+
+func zstdDecodeWithNewReader(data []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeAll(data, nil)
+}
+
+func BenchmarkZSTDEncode(b *testing.B) {
+	c := NewZSTDCompressor(10, 2)
+	b.SetBytes(int64(len(benchmarkZSTDData)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := c.Encode(benchmarkZSTDData)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkZSTDEncodeNewWriter(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkZSTDData)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := zstdEncodeWithNewWriter(benchmarkZSTDData, 2)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkZSTDDecode(b *testing.B) {
+	c := NewZSTDCompressor(10, 2)
+	buf, _ := c.Encode(benchmarkZSTDData)
+	b.SetBytes(int64(len(benchmarkZSTDData)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := c.Decode(buf)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkZSTDDecodeNewReader(b *testing.B) {
+	buf, _ := zstdEncodeWithNewWriter(benchmarkZSTDData, 2)
+	b.SetBytes(int64(len(benchmarkZSTDData)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := zstdDecodeWithNewReader(buf)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
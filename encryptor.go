@@ -0,0 +1,103 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+var ErrEncryptKeyIsNil = errors.New("Encrypt key is nil")
+var ErrEncryptKeyNotFound = errors.New("Encrypt key not found")
+var ErrDecryptFail = errors.New("Decrypt fail")
+
+// EncryptorKey is the key of encryptor
+type EncryptorKey struct {
+	// ID is recorded with the encrypted data, it is used to find the key for decryption
+	ID byte
+	// Key is the aes key, it should be 16, 24 or 32 bytes
+	Key []byte
+}
+
+// Encryptor encrypts and decrypts data with AES-GCM,
+// it supports multiple keys for key rotation.
+//
+// The layout of encrypted data: key id(1) | nonce(12) | ciphertext
+type Encryptor struct {
+	currentID byte
+	aeads     map[byte]cipher.AEAD
+}
+
+// NewEncryptor creates a new encryptor, the first key is used for encryption,
+// and all keys are used for decryption by the key id of data
+func NewEncryptor(keys ...EncryptorKey) (*Encryptor, error) {
+	if len(keys) == 0 {
+		return nil, ErrEncryptKeyIsNil
+	}
+	aeads := make(map[byte]cipher.AEAD, len(keys))
+	for _, key := range keys {
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[key.ID] = aead
+	}
+	return &Encryptor{
+		currentID: keys[0].ID,
+		aeads:     aeads,
+	}, nil
+}
+
+// Encrypt encrypts the data with current key,
+// the additional data is authenticated but not encrypted
+func (e *Encryptor) Encrypt(data, additionalData []byte) ([]byte, error) {
+	aead := e.aeads[e.currentID]
+	nonceSize := aead.NonceSize()
+	buf := make([]byte, 1+nonceSize, 1+nonceSize+len(data)+aead.Overhead())
+	buf[0] = e.currentID
+	nonce := buf[1 : 1+nonceSize]
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(buf, nonce, data, additionalData), nil
+}
+
+// Decrypt decrypts the data with the key of key id,
+// the additional data should be the same as encryption
+func (e *Encryptor) Decrypt(data, additionalData []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrDecryptFail
+	}
+	aead, ok := e.aeads[data[0]]
+	if !ok {
+		return nil, ErrEncryptKeyNotFound
+	}
+	nonceSize := aead.NonceSize()
+	if len(data) < 1+nonceSize+aead.Overhead() {
+		return nil, ErrDecryptFail
+	}
+	buf, err := aead.Open(nil, data[1:1+nonceSize], data[1+nonceSize:], additionalData)
+	if err != nil {
+		return nil, ErrDecryptFail
+	}
+	return buf, nil
+}
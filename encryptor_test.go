@@ -0,0 +1,201 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testEncryptorKey1 = EncryptorKey{
+	ID:  1,
+	Key: []byte("0123456789abcdef0123456789abcdef"),
+}
+
+var testEncryptorKey2 = EncryptorKey{
+	ID:  2,
+	Key: []byte("fedcba9876543210fedcba9876543210"),
+}
+
+func TestEncryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewEncryptor()
+	assert.Equal(ErrEncryptKeyIsNil, err)
+	_, err = NewEncryptor(EncryptorKey{ID: 1, Key: []byte("abc")})
+	assert.NotNil(err)
+
+	e1, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	data := []byte("Hello World!")
+	buf, err := e1.Encrypt(data, []byte("key"))
+	assert.Nil(err)
+	assert.Equal(testEncryptorKey1.ID, buf[0])
+	assert.False(bytes.Contains(buf, data))
+
+	result, err := e1.Decrypt(buf, []byte("key"))
+	assert.Nil(err)
+	assert.Equal(data, result)
+
+	// 附加数据不一致
+	_, err = e1.Decrypt(buf, []byte("other"))
+	assert.Equal(ErrDecryptFail, err)
+	_, err = e1.Decrypt(buf[:10], []byte("key"))
+	assert.Equal(ErrDecryptFail, err)
+
+	// 轮换key，旧数据仍可解密
+	e2, err := NewEncryptor(testEncryptorKey2, testEncryptorKey1)
+	assert.Nil(err)
+	result, err = e2.Decrypt(buf, []byte("key"))
+	assert.Nil(err)
+	assert.Equal(data, result)
+	buf, err = e2.Encrypt(data, []byte("key"))
+	assert.Nil(err)
+	assert.Equal(testEncryptorKey2.ID, buf[0])
+	_, err = e1.Decrypt(buf, []byte("key"))
+	assert.Equal(ErrEncryptKeyNotFound, err)
+}
+
+func TestCacheEncryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	e, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	errCount := 0
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheSnappyOption(10),
+		CacheEncryptorOption(e),
+		CacheChecksumOption(),
+		CacheOnErrorOption(func(key string, err error) {
+			errCount++
+		}),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key := randomString()
+	value := []byte("Hello World!Hello World!Hello World!")
+	err = c.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	buf, err := store.Get(context.Background(), key)
+	assert.Nil(err)
+	assert.False(bytes.Contains(buf, []byte("Hello")))
+
+	result, err := c.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, result)
+
+	// 未配置加密的缓存无法读取
+	plainCache, err := New(time.Minute, CacheStoreOption(store))
+	assert.Nil(err)
+	_, err = plainCache.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+
+	// 复制至其它key的数据无法解密
+	otherKey := randomString()
+	err = store.Set(context.Background(), otherKey, buf, time.Minute)
+	assert.Nil(err)
+	_, err = c.GetBytes(context.Background(), otherKey)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal(1, errCount)
+
+	// 由未知的key加密的数据当作不存在，但不删除
+	e2, err := NewEncryptor(testEncryptorKey2)
+	assert.Nil(err)
+	otherCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheEncryptorOption(e2),
+		CacheOnErrorOption(func(key string, err error) {
+			errCount++
+		}),
+	)
+	assert.Nil(err)
+	_, err = otherCache.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal(1, errCount)
+	result, err = c.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, result)
+}
+
+func TestRedisCacheEncryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	e, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c, RedisCacheEncryptorOption(e))
+	key := randomString()
+
+	err = srv.SetStruct(context.Background(), key, &testData{Name: "abc"})
+	assert.Nil(err)
+	buf, err := srv.Get(context.Background(), key)
+	assert.Nil(err)
+	assert.False(bytes.Contains(buf, []byte("abc")))
+	data := testData{}
+	err = srv.GetStruct(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("abc", data.Name)
+
+	err = srv.SetStructWithTTL(context.Background(), key, &testData{Name: "def"}, time.Minute)
+	assert.Nil(err)
+	ttl, err := srv.GetStructAndTTL(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("def", data.Name)
+	assert.Greater(ttl, 59*time.Second)
+
+	_, err = srv.Del(context.Background(), key)
+	assert.Nil(err)
+}
+
+func TestRedisSessionEncryptor(t *testing.T) {
+	assert := assert.New(t)
+
+	e, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	c := newClient()
+	defer c.Close()
+	rs := NewRedisSession(c)
+	rs.SetEncryptor(e)
+	key := randomString()
+	ctx := context.Background()
+
+	data := []byte(`{"account":"tree"}`)
+	err = rs.Set(ctx, key, data, time.Minute)
+	assert.Nil(err)
+	buf, err := c.Get(ctx, key).Bytes()
+	assert.Nil(err)
+	assert.False(bytes.Contains(buf, []byte("tree")))
+
+	result, err := rs.Get(ctx, key)
+	assert.Nil(err)
+	assert.Equal(data, result)
+
+	err = rs.Destroy(ctx, key)
+	assert.Nil(err)
+	result, err = rs.Get(ctx, key)
+	assert.Nil(err)
+	assert.Empty(result)
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// The layout of envelope:
+//
+//	expired at(8 bytes) | magic(1) | version(1) | flags(1) | codec(1) | checksum(4, optional) | compress type(1) | payload | signature(33, optional)
+//
+// The checksum is the crc32c of the header (without expired time) and
+// the data after it, it exists only if the checksum flag is set. If the encrypted flag is set, the compress type
+// and payload are encrypted by Encryptor, and the key id is the first byte
+// after checksum. If the signed flag is set, the signature of key, header
+// (without expired time) and data is appended by Signer.
+// The expired time is still the first 8 bytes as the legacy entry,
+// so the header can be touched or peeked without knowing the version.
+// The compress type is the first byte of compressor's output,
+// it is CompressNone if the cache has no compressor.
+//
+// If the versioned flag is set, the version(8 bytes) of data is written after
+// codec, it is a random number generated for each write and is not changed
+// by touching, so it can be compared by the store for CompareAndSwap.
+//
+// The version 2 is written by the cache with transformers, the ids of
+// transformers are recorded after codec, and the compress type is not
+// written as the compression is one of transformers:
+//
+//	expired at(8 bytes) | magic(1) | version(1) | flags(1) | codec(1) | data version(8, optional) | stage count(1) | stage ids(n) | checksum(4, optional) | payload | signature(33, optional)
+//
+// The encrypted flag is not used by version 2.
+const (
+	// envelopeMagic is an invalid byte of utf-8, it is used to
+	// distinguish from the legacy entry which is json in most cases
+	envelopeMagic byte = 0xfe
+	// envelopeVersionLegacy is the entry without envelope:
+	// expired at(8 bytes) | compress type(1, only if compressor is set) | payload
+	envelopeVersionLegacy byte = 0
+	envelopeVersion1      byte = 1
+	envelopeVersion2      byte = 2
+
+	envelopeHeaderSize = timestampByteSize + 4
+	checksumSize       = 4
+	versionSize        = 8
+)
+
+const (
+	// envelopeFlagChecksum the checksum of data is recorded
+	envelopeFlagChecksum byte = 1 << iota
+	// envelopeFlagEncrypted the data is encrypted
+	envelopeFlagEncrypted
+	// envelopeFlagSigned the signature of data is appended
+	envelopeFlagSigned
+	// envelopeFlagVersioned the version of data is recorded
+	envelopeFlagVersioned
+
+	envelopeFlagMask = envelopeFlagChecksum | envelopeFlagEncrypted | envelopeFlagSigned | envelopeFlagVersioned
+)
+
+var errEnvelopeUnknown = errors.New("Unknown envelope")
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+type envelope struct {
+	version byte
+	flags   byte
+	codec   byte
+	// stages is the ids of transformers, it exists only if version is 2
+	stages []byte
+	// header is the header without expired time, it is signed with data
+	header []byte
+	// data is the data after header,
+	// it includes compress type if version is not legacy
+	data      []byte
+	signature []byte
+}
+
+// envelopeStagesOffset returns the offset of stage count for the flags
+func envelopeStagesOffset(flags byte) int {
+	if flags&envelopeFlagVersioned != 0 {
+		return envelopeHeaderSize + versionSize
+	}
+	return envelopeHeaderSize
+}
+
+// envelopeHeaderEnd returns the end of header(before checksum),
+// the buf should have the magic and supported version
+func envelopeHeaderEnd(buf []byte) int {
+	offset := envelopeStagesOffset(buf[timestampByteSize+2])
+	if buf[timestampByteSize+1] == envelopeVersion2 {
+		return offset + 1 + int(buf[offset])
+	}
+	return offset
+}
+
+// envelopeDataOffset returns the offset of data for the header end and flags
+func envelopeDataOffset(headerEnd int, flags byte) int {
+	offset := headerEnd
+	if flags&envelopeFlagChecksum != 0 {
+		offset += checksumSize
+	}
+	return offset
+}
+
+// newEnvelope creates the envelope bytes with the size of data,
+// it returns the bytes and the offset of data. The version 2 will be used
+// if stages is not nil. The data should be copied to buf[offset:offset+size]
+// and sealed by sealEnvelope, the expired time should be written later.
+// The version of data should be written by writeEnvelopeVersion before sealing
+// if the versioned flag is set.
+func newEnvelope(flags, codec byte, stages []byte, size int) ([]byte, int) {
+	version := envelopeVersion1
+	headerEnd := envelopeStagesOffset(flags)
+	stagesOffset := headerEnd
+	if stages != nil {
+		version = envelopeVersion2
+		headerEnd += 1 + len(stages)
+	}
+	offset := envelopeDataOffset(headerEnd, flags)
+	if flags&envelopeFlagSigned != 0 {
+		size += signatureSize
+	}
+	buf := make([]byte, offset+size)
+	buf[timestampByteSize] = envelopeMagic
+	buf[timestampByteSize+1] = version
+	buf[timestampByteSize+2] = flags
+	buf[timestampByteSize+3] = codec
+	if stages != nil {
+		buf[stagesOffset] = byte(len(stages))
+		copy(buf[stagesOffset+1:], stages)
+	}
+	return buf, offset
+}
+
+// writeEnvelopeVersion writes the version of data to the envelope with versioned flag
+func writeEnvelopeVersion(buf []byte, version uint64) {
+	binary.BigEndian.PutUint64(buf[envelopeHeaderSize:], version)
+}
+
+// envelopeChecksum returns the crc32c of the header without expired time and
+// the data after checksum, the expired time is excluded as it is changed by touching
+func envelopeChecksum(buf []byte, headerEnd, offset int) uint32 {
+	sum := crc32.Checksum(buf[timestampByteSize:headerEnd], crc32cTable)
+	return crc32.Update(sum, crc32cTable, buf[offset:])
+}
+
+// sealEnvelope writes the signature of data if the signed flag is set,
+// and then writes the checksum if the checksum flag is set
+func sealEnvelope(buf []byte, key string, signer *Signer) {
+	flags := buf[timestampByteSize+2]
+	headerEnd := envelopeHeaderEnd(buf)
+	offset := envelopeDataOffset(headerEnd, flags)
+	if flags&envelopeFlagSigned != 0 {
+		end := len(buf) - signatureSize
+		signature := signer.Sign([]byte(key), buf[timestampByteSize:headerEnd], buf[offset:end])
+		copy(buf[end:], signature)
+	}
+	if flags&envelopeFlagChecksum != 0 {
+		binary.BigEndian.PutUint32(buf[headerEnd:], envelopeChecksum(buf, headerEnd, offset))
+	}
+}
+
+// parseEnvelope parses the entry bytes, the entry without magic will be
+// treated as legacy. It returns errEnvelopeUnknown if the version or
+// flags is not supported, and ErrChecksumMismatch if the data is corrupted.
+// The signature is not verified, it should be verified by Signer.
+func parseEnvelope(buf []byte) (*envelope, error) {
+	if len(buf) <= timestampByteSize || buf[timestampByteSize] != envelopeMagic {
+		return &envelope{
+			version: envelopeVersionLegacy,
+			data:    buf[timestampByteSize:],
+		}, nil
+	}
+	if len(buf) <= envelopeHeaderSize {
+		return nil, errEnvelopeUnknown
+	}
+	// 由更新版本写入的数据，无法解析
+	version := buf[timestampByteSize+1]
+	if version != envelopeVersion1 && version != envelopeVersion2 {
+		return nil, errEnvelopeUnknown
+	}
+	flags := buf[timestampByteSize+2]
+	if flags&^envelopeFlagMask != 0 {
+		return nil, errEnvelopeUnknown
+	}
+	// 数据不完整，无法获取transformer的数量
+	stagesOffset := envelopeStagesOffset(flags)
+	if version == envelopeVersion2 && len(buf) <= stagesOffset {
+		return nil, errEnvelopeUnknown
+	}
+	headerEnd := envelopeHeaderEnd(buf)
+	offset := envelopeDataOffset(headerEnd, flags)
+	hasChecksum := flags&envelopeFlagChecksum != 0
+	if len(buf) <= offset {
+		// 有校验和的数据被截断
+		if hasChecksum {
+			return nil, ErrChecksumMismatch
+		}
+		return nil, errEnvelopeUnknown
+	}
+	data := buf[offset:]
+	if hasChecksum {
+		sum := binary.BigEndian.Uint32(buf[headerEnd:])
+		if envelopeChecksum(buf, headerEnd, offset) != sum {
+			return nil, ErrChecksumMismatch
+		}
+	}
+	var signature []byte
+	if flags&envelopeFlagSigned != 0 {
+		if len(data) <= signatureSize {
+			return nil, ErrSignatureMismatch
+		}
+		end := len(data) - signatureSize
+		signature = data[end:]
+		data = data[:end]
+	}
+	var stages []byte
+	if version == envelopeVersion2 {
+		stages = buf[stagesOffset+1 : headerEnd]
+	}
+	return &envelope{
+		version:   version,
+		flags:     flags,
+		codec:     buf[timestampByteSize+3],
+		stages:    stages,
+		header:    buf[timestampByteSize:headerEnd],
+		data:      data,
+		signature: signature,
+	}, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newLegacyEntry creates the entry without envelope
+func newLegacyEntry(compressor Compressor, value []byte) []byte {
+	if compressor != nil {
+		value, _ = compressor.Encode(value)
+	}
+	data := make([]byte, len(value)+timestampByteSize)
+	writeTimeToBytes(time.Now().Add(time.Minute), data)
+	copy(data[timestampByteSize:], value)
+	return data
+}
+
+func TestParseEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	buf, offset := newEnvelope(0, CodecRaw, nil, 3)
+	copy(buf[offset:], "abc")
+	env, err := parseEnvelope(buf)
+	assert.Nil(err)
+	assert.Equal(envelopeVersion1, env.version)
+	assert.Equal(CodecRaw, env.codec)
+	assert.Equal([]byte("abc"), env.data)
+
+	// 旧版本的数据
+	env, err = parseEnvelope(newLegacyEntry(nil, []byte(`{"name":"a"}`)))
+	assert.Nil(err)
+	assert.Equal(envelopeVersionLegacy, env.version)
+	assert.Equal([]byte(`{"name":"a"}`), env.data)
+
+	// 校验和
+	buf, offset = newEnvelope(envelopeFlagChecksum, CodecRaw, nil, 3)
+	copy(buf[offset:], "abc")
+	sealEnvelope(buf, "", nil)
+	env, err = parseEnvelope(buf)
+	assert.Nil(err)
+	assert.Equal([]byte("abc"), env.data)
+	buf[len(buf)-1] = 'd'
+	_, err = parseEnvelope(buf)
+	assert.Equal(ErrChecksumMismatch, err)
+	_, err = parseEnvelope(buf[:envelopeHeaderSize+2])
+	assert.Equal(ErrChecksumMismatch, err)
+	// 数据头也在校验范围内
+	buf[len(buf)-1] = 'c'
+	buf[timestampByteSize+3] = CodecGob
+	_, err = parseEnvelope(buf)
+	assert.Equal(ErrChecksumMismatch, err)
+
+	// 未知版本
+	buf[timestampByteSize+1] = 100
+	_, err = parseEnvelope(buf)
+	assert.Equal(errEnvelopeUnknown, err)
+}
+
+func TestCacheEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+	)
+	assert.Nil(err)
+	compressCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheSnappyOption(10),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	value := []byte("Hello World!Hello World!Hello World!")
+
+	// 旧版本的数据
+	key := randomString()
+	err = store.Set(context.Background(), key, newLegacyEntry(nil, value), time.Minute)
+	assert.Nil(err)
+	buf, err := c.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 未压缩的旧版本数据在开启压缩后当作不存在
+	key = randomString()
+	err = store.Set(context.Background(), key, newLegacyEntry(nil, []byte(`{"name":"a"}`)), time.Minute)
+	assert.Nil(err)
+	_, err = compressCache.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+	data := testData{}
+	err = compressCache.Get(context.Background(), key, &data)
+	assert.Equal(ErrIsNil, err)
+
+	key = randomString()
+	err = store.Set(context.Background(), key, newLegacyEntry(NewSnappyCompressor(10), value), time.Minute)
+	assert.Nil(err)
+	buf, err = compressCache.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 未压缩的数据可由配置了压缩的缓存读取
+	key = randomString()
+	err = c.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	buf, err = compressCache.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 内置算法压缩的数据可由未配置压缩的缓存读取
+	key = randomString()
+	err = compressCache.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	buf, err = c.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 自定义压缩的数据无法解压时当作不存在
+	customCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCompressorOption(NewCompressor(CompressorOption{
+			MinCompressLength: 10,
+			Encode:            snappyEncode,
+			Decode:            snappyDecode,
+		})),
+	)
+	assert.Nil(err)
+	key = randomString()
+	err = customCache.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	_, err = c.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+
+	// 未知版本当作不存在
+	key = randomString()
+	buf, offset := newEnvelope(0, CodecDefault, nil, len(value)+1)
+	buf[timestampByteSize+1] = envelopeVersion2 + 1
+	copy(buf[offset+1:], value)
+	writeTimeToBytes(time.Now().Add(time.Minute), buf)
+	err = store.Set(context.Background(), key, buf, time.Minute)
+	assert.Nil(err)
+	_, err = c.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+}
+
+func TestCacheChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	s2, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	errKeys := make([]string, 0)
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(s2),
+		CacheChecksumOption(),
+		CacheOnErrorOption(func(key string, err error) {
+			assert.Equal(ErrChecksumMismatch, err)
+			errKeys = append(errKeys, key)
+		}),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key := randomString()
+	value := []byte("value")
+	err = c.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+
+	corrupt := func(s Store) {
+		buf, err := s.Get(context.Background(), key)
+		assert.Nil(err)
+		buf[len(buf)-1]++
+		err = s.Set(context.Background(), key, buf, time.Minute)
+		assert.Nil(err)
+	}
+
+	// 一级缓存数据损坏，从二级缓存中获取
+	corrupt(s1)
+	buf, err := c.GetBytes(context.Background(), key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+	assert.Equal([]string{key}, errKeys)
+
+	// 均损坏，当作不存在并删除
+	corrupt(s1)
+	corrupt(s2)
+	_, err = c.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal([]string{key, key, key}, errKeys)
+	_, err = s1.Get(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+	_, err = s2.Get(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+
+	// 数据头的codec被修改，当作损坏的数据
+	err = c.SetBytes(context.Background(), key, value)
+	assert.Nil(err)
+	for _, s := range []Store{s1, s2} {
+		buf, err := s.Get(context.Background(), key)
+		assert.Nil(err)
+		buf[timestampByteSize+3]++
+		err = s.Set(context.Background(), key, buf, time.Minute)
+		assert.Nil(err)
+	}
+	_, err = c.GetBytes(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal([]string{key, key, key, key, key}, errKeys)
+	_, err = s2.Get(context.Background(), key)
+	assert.Equal(ErrIsNil, err)
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const defaultKeyMutexSize = 64
+
+// keyMutex is a striped mutex, the keys are hashed to a fixed number of mutexes
+type keyMutex struct {
+	mutexes []sync.Mutex
+}
+
+func newKeyMutex(size int) *keyMutex {
+	if size <= 0 {
+		size = defaultKeyMutexSize
+	}
+	return &keyMutex{
+		mutexes: make([]sync.Mutex, size),
+	}
+}
+
+// get returns the mutex of key
+func (km *keyMutex) get(key string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &km.mutexes[h.Sum32()%uint32(len(km.mutexes))]
+}
@@ -28,7 +28,15 @@ type Option struct {
 	hardMaxCacheSize int
 	shards           int
 	compressor       Compressor
+	codec            Codec
+	checksum         bool
+	versioned        bool
+	encryptor        *Encryptor
+	signer           *Signer
+	chunkSize        int
+	transformers     []Transformer
 	onRemove         func(key string)
+	onError          func(key string, err error)
 }
 
 // CacheOption cache option
@@ -98,13 +106,90 @@ func CacheCompressorOption(compressor Compressor) CacheOption {
 }
 
 // CacheSnappyOption set snappy compress for store
-func CacheSnappyOption(minCompressLength int) CacheOption {
-	return CacheCompressorOption(NewSnappyCompressor(minCompressLength))
+func CacheSnappyOption(minCompressLength int, opts ...CompressorAdaptiveOption) CacheOption {
+	return CacheCompressorOption(NewSnappyCompressor(minCompressLength, opts...))
 }
 
 // CacheZSTDOption set zstd compress for store
-func CacheZSTDOption(minCompressLength, level int) CacheOption {
-	return CacheCompressorOption(NewZSTDCompressor(minCompressLength, level))
+func CacheZSTDOption(minCompressLength, level int, opts ...CompressorAdaptiveOption) CacheOption {
+	return CacheCompressorOption(NewZSTDCompressor(minCompressLength, level, opts...))
+}
+
+// CacheCodecOption set codec for cache, the id of codec will be recorded with the data
+func CacheCodecOption(codec Codec) CacheOption {
+	return func(opt *Option) {
+		opt.codec = codec
+	}
+}
+
+// CacheChecksumOption set the cache to record the crc32c checksum of data,
+// the corrupted data will be treated as not exists and deleted from store
+func CacheChecksumOption() CacheOption {
+	return func(opt *Option) {
+		opt.checksum = true
+	}
+}
+
+// CacheVersionOption set the cache to record the version of data,
+// it is required by GetWithVersion and SetIfVersion
+func CacheVersionOption() CacheOption {
+	return func(opt *Option) {
+		opt.versioned = true
+	}
+}
+
+// CacheEncryptorOption set encryptor for cache, the data will be encrypted after compression
+func CacheEncryptorOption(encryptor *Encryptor) CacheOption {
+	return func(opt *Option) {
+		opt.encryptor = encryptor
+	}
+}
+
+// CacheSignerOption set signer for cache, the hmac of key and data will be appended,
+// the data without valid signature will be treated as not exists
+func CacheSignerOption(signer *Signer) CacheOption {
+	return func(opt *Option) {
+		opt.signer = signer
+	}
+}
+
+// CacheOnErrorOption set on error function for cache, it is called
+// when the data of store is corrupted or tampered
+func CacheOnErrorOption(onError func(key string, err error)) CacheOption {
+	return func(opt *Option) {
+		opt.onError = onError
+	}
+}
+
+// CacheS2Option set s2 compress for store
+func CacheS2Option(minCompressLength int, opts ...CompressorAdaptiveOption) CacheOption {
+	return CacheCompressorOption(NewS2Compressor(minCompressLength, opts...))
+}
+
+// CacheGzipOption set gzip compress for store
+func CacheGzipOption(minCompressLength, level int, opts ...CompressorAdaptiveOption) CacheOption {
+	return CacheCompressorOption(NewGzipCompressor(minCompressLength, level, opts...))
+}
+
+// CacheFlateOption set flate compress for store
+func CacheFlateOption(minCompressLength, level int, opts ...CompressorAdaptiveOption) CacheOption {
+	return CacheCompressorOption(NewFlateCompressor(minCompressLength, level, opts...))
+}
+
+// CacheTransformerOption set the transformer chain for cache, the transformers
+// run in order on write and in reverse order on read. It can not be used with
+// the compressor and encryptor option.
+func CacheTransformerOption(transformers ...Transformer) CacheOption {
+	return func(opt *Option) {
+		opt.transformers = transformers
+	}
+}
+
+// CacheChunkSizeOption set the chunk size of SetReader, the default size is 256KB
+func CacheChunkSizeOption(chunkSize int) CacheOption {
+	return func(opt *Option) {
+		opt.chunkSize = chunkSize
+	}
 }
 
 // CacheMultiTTLOption set multi ttl for store
@@ -31,6 +31,10 @@ func TestCacheOption(t *testing.T) {
 		}),
 		CacheKeyPrefixOption("prefix"),
 		CacheZSTDOption(10, 1),
+		CacheCodecOption(&testJSONCodec{id: 100}),
+		CacheChecksumOption(),
+		CacheOnErrorOption(func(key string, err error) {
+		}),
 		CacheMultiTTLOption([]time.Duration{
 			time.Second,
 			2 * time.Second,
@@ -46,6 +50,9 @@ func TestCacheOption(t *testing.T) {
 	assert.Equal(1024*1024, opt.hardMaxCacheSize)
 	assert.NotNil(opt.onRemove)
 	assert.NotNil(opt.compressor)
+	assert.NotNil(opt.codec)
+	assert.True(opt.checksum)
+	assert.NotNil(opt.onError)
 	assert.Equal([]time.Duration{
 		time.Second,
 		2 * time.Second,
@@ -0,0 +1,336 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm is the algorithm of rate limiter
+type RateLimitAlgorithm int
+
+const (
+	// RateLimitFixedWindow counts the requests of fixed window,
+	// it allows 2*limit requests at the edge of windows
+	RateLimitFixedWindow RateLimitAlgorithm = iota + 1
+	// RateLimitSlidingWindowLog records the time of each request,
+	// it is accurate but the memory is proportional to limit
+	RateLimitSlidingWindowLog
+	// RateLimitSlidingWindowCounter estimates the count of sliding window
+	// with the weighted count of previous window
+	RateLimitSlidingWindowCounter
+	// RateLimitTokenBucket refills limit tokens per period, the capacity is burst
+	RateLimitTokenBucket
+	// RateLimitGCRA is the generic cell rate algorithm, it spaces the requests
+	// evenly and allows burst requests at once
+	RateLimitGCRA
+)
+
+var ErrRateLimitInvalid = errors.New("Rate limit is invalid")
+var ErrRateLimitAlgorithmUnknown = errors.New("Rate limit algorithm is unknown")
+var ErrRateLimitCountInvalid = errors.New("Rate limit count is invalid")
+
+// RateLimit allows limit requests per period, the burst is the capacity
+// of token bucket and GCRA, it is limit if not set
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// RateLimitResult is the result of rate limiter
+type RateLimitResult struct {
+	// Allowed is true if the requests are allowed
+	Allowed bool
+	// Limit is the limit of rate limiter
+	Limit int
+	// Remaining is the count of requests allowed now
+	Remaining int
+	// RetryAfter is the time to wait before the requests are allowed, it is 0 if allowed
+	RetryAfter time.Duration
+	// ResetAfter is the time to wait before the limiter is reset to the initial state
+	ResetAfter time.Duration
+}
+
+// RateLimiter limits the rate of requests by key
+type RateLimiter interface {
+	// Allow is shorthand for AllowN(ctx, key, 1)
+	Allow(ctx context.Context, key string) (*RateLimitResult, error)
+	// AllowN reports whether n requests are allowed now, the denied
+	// requests do not consume the quota
+	AllowN(ctx context.Context, key string, n int) (*RateLimitResult, error)
+	// Reset resets the limiter of key
+	Reset(ctx context.Context, key string) error
+}
+
+// capacity returns the max count of requests allowed at once
+func (l RateLimit) capacity(algorithm RateLimitAlgorithm) int {
+	if algorithm == RateLimitTokenBucket || algorithm == RateLimitGCRA {
+		if l.Burst > 0 {
+			return l.Burst
+		}
+	}
+	return l.Limit
+}
+
+func validateRateLimit(algorithm RateLimitAlgorithm, limit RateLimit) error {
+	if algorithm < RateLimitFixedWindow || algorithm > RateLimitGCRA {
+		return ErrRateLimitAlgorithmUnknown
+	}
+	if limit.Limit <= 0 || limit.Period <= 0 || limit.Burst < 0 {
+		return ErrRateLimitInvalid
+	}
+	return nil
+}
+
+// newRateLimitResult creates the result from the values of algorithm,
+// the time values are microseconds
+func newRateLimitResult(limit int, values []int64) *RateLimitResult {
+	remaining := int(values[1])
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		ResetAfter: time.Duration(values[3]) * time.Microsecond,
+	}
+}
+
+// memoryRateLimitEntry is the state of key, the time values are microseconds
+type memoryRateLimitEntry struct {
+	// fixed window and sliding window counter
+	window int64
+	count  float64
+	prev   float64
+	// sliding window log
+	logs []int64
+	// token bucket
+	tokens    float64
+	updatedAt int64
+	// gcra
+	tat float64
+
+	expiredAt int64
+}
+
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	algorithm RateLimitAlgorithm
+	limit     RateLimit
+	entries   map[string]*memoryRateLimitEntry
+	sweptAt   int64
+	now       func() time.Time
+}
+
+// NewMemoryRateLimiter creates a rate limiter of memory, it has the
+// same behavior as the rate limiter of redis and is used for single node
+func NewMemoryRateLimiter(algorithm RateLimitAlgorithm, limit RateLimit) (RateLimiter, error) {
+	err := validateRateLimit(algorithm, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryRateLimiter{
+		algorithm: algorithm,
+		limit:     limit,
+		entries:   make(map[string]*memoryRateLimitEntry),
+		now:       time.Now,
+	}, nil
+}
+
+// Allow is shorthand for AllowN(ctx, key, 1)
+func (m *memoryRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return m.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n requests are allowed now
+func (m *memoryRateLimiter) AllowN(_ context.Context, key string, n int) (*RateLimitResult, error) {
+	if key == "" {
+		return nil, ErrKeyIsNil
+	}
+	if n <= 0 || n > m.limit.capacity(m.algorithm) {
+		return nil, ErrRateLimitCountInvalid
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now().UnixMicro()
+	m.sweep(now)
+	entry := m.entries[key]
+	if entry == nil || entry.expiredAt <= now {
+		entry = &memoryRateLimitEntry{}
+	}
+	period := float64(m.limit.Period.Microseconds())
+	limit := float64(m.limit.Limit)
+	var values []int64
+	switch m.algorithm {
+	case RateLimitFixedWindow:
+		values = entry.fixedWindow(now, period, limit, n)
+	case RateLimitSlidingWindowLog:
+		values = entry.slidingWindowLog(now, period, limit, n)
+	case RateLimitSlidingWindowCounter:
+		values = entry.slidingWindowCounter(now, period, limit, n)
+	case RateLimitTokenBucket:
+		values = entry.tokenBucket(now, period, limit, float64(m.limit.capacity(m.algorithm)), n)
+	default:
+		values = entry.gcra(now, period, limit, float64(m.limit.capacity(m.algorithm)), n)
+	}
+	// 允许时更新状态
+	if values[0] == 1 {
+		m.entries[key] = entry
+	}
+	return newRateLimitResult(m.limit.Limit, values), nil
+}
+
+// Reset resets the limiter of key
+func (m *memoryRateLimiter) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// sweep removes the expired entries at most once per period
+func (m *memoryRateLimiter) sweep(now int64) {
+	if now-m.sweptAt < m.limit.Period.Microseconds() {
+		return
+	}
+	m.sweptAt = now
+	for key, entry := range m.entries {
+		if entry.expiredAt <= now {
+			delete(m.entries, key)
+		}
+	}
+}
+
+func ceilMicro(value float64) int64 {
+	return int64(math.Ceil(value))
+}
+
+func (e *memoryRateLimitEntry) fixedWindow(now int64, period, limit float64, n int) []int64 {
+	window := int64(math.Floor(float64(now) / period))
+	count := 0.0
+	if e.window == window {
+		count = e.count
+	}
+	reset := ceilMicro(float64(window+1)*period) - now
+	if count+float64(n) > limit {
+		return []int64{0, int64(limit - count), reset, reset}
+	}
+	e.window = window
+	e.count = count + float64(n)
+	e.expiredAt = now + reset
+	return []int64{1, int64(limit - e.count), 0, reset}
+}
+
+func (e *memoryRateLimitEntry) slidingWindowLog(now int64, period, limit float64, n int) []int64 {
+	// 清除窗口外的记录
+	start := now - int64(period)
+	index := sort.Search(len(e.logs), func(i int) bool {
+		return e.logs[i] > start
+	})
+	logs := e.logs[index:]
+	count := len(logs)
+	if float64(count+n) > limit {
+		retry := logs[count+n-int(limit)-1] + int64(period) - now
+		reset := logs[count-1] + int64(period) - now
+		return []int64{0, int64(limit) - int64(count), retry, reset}
+	}
+	for i := 0; i < n; i++ {
+		logs = append(logs, now)
+	}
+	e.logs = logs
+	e.expiredAt = now + int64(period)
+	return []int64{1, int64(limit) - int64(len(logs)), 0, int64(period)}
+}
+
+func (e *memoryRateLimitEntry) slidingWindowCounter(now int64, period, limit float64, n int) []int64 {
+	window := int64(math.Floor(float64(now) / period))
+	count := 0.0
+	prev := 0.0
+	if e.window == window {
+		count = e.count
+		prev = e.prev
+	} else if e.window == window-1 {
+		prev = e.count
+	}
+	elapsed := float64(now) - float64(window)*period
+	estimate := prev*(period-elapsed)/period + count
+	if estimate+float64(n) > limit {
+		var retry float64
+		if count+float64(n) <= limit {
+			// 当前窗口内等待上一窗口的权重下降
+			retry = period*(prev-(limit-count-float64(n)))/prev - elapsed
+		} else {
+			// 等待下一窗口，当前窗口的计数成为上一窗口
+			retry = period - elapsed
+			if count > limit-float64(n) {
+				retry += period * (count - (limit - float64(n))) / count
+			}
+		}
+		reset := period - elapsed
+		if count > 0 {
+			reset += period
+		}
+		return []int64{0, int64(math.Floor(limit - estimate)), ceilMicro(retry), ceilMicro(reset)}
+	}
+	e.window = window
+	e.count = count + float64(n)
+	e.prev = prev
+	reset := ceilMicro(2*period - elapsed)
+	e.expiredAt = now + reset
+	return []int64{1, int64(math.Floor(limit - estimate - float64(n))), 0, reset}
+}
+
+func (e *memoryRateLimitEntry) tokenBucket(now int64, period, limit, burst float64, n int) []int64 {
+	rate := limit / period
+	tokens := burst
+	if e.expiredAt != 0 {
+		tokens = math.Min(burst, e.tokens+float64(now-e.updatedAt)*rate)
+	}
+	if tokens < float64(n) {
+		return []int64{0, int64(math.Floor(tokens)), ceilMicro((float64(n) - tokens) / rate), ceilMicro((burst - tokens) / rate)}
+	}
+	tokens -= float64(n)
+	reset := ceilMicro((burst - tokens) / rate)
+	e.tokens = tokens
+	e.updatedAt = now
+	e.expiredAt = now + reset
+	return []int64{1, int64(math.Floor(tokens)), 0, reset}
+}
+
+func (e *memoryRateLimitEntry) gcra(now int64, period, limit, burst float64, n int) []int64 {
+	interval := period / limit
+	tat := float64(now)
+	if e.expiredAt != 0 && e.tat > tat {
+		tat = e.tat
+	}
+	newTat := tat + float64(n)*interval
+	diff := float64(now) - (newTat - burst*interval)
+	if diff < 0 {
+		remaining := math.Floor((float64(now) - (tat - burst*interval)) / interval)
+		return []int64{0, int64(remaining), ceilMicro(-diff), ceilMicro(tat - float64(now))}
+	}
+	e.tat = newTat
+	reset := ceilMicro(newTat - float64(now))
+	e.expiredAt = now + reset
+	return []int64{1, int64(math.Floor(diff / interval)), 0, reset}
+}
@@ -0,0 +1,196 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rateLimitAlgorithms = []RateLimitAlgorithm{
+	RateLimitFixedWindow,
+	RateLimitSlidingWindowLog,
+	RateLimitSlidingWindowCounter,
+	RateLimitTokenBucket,
+	RateLimitGCRA,
+}
+
+// testRateLimiter tests the common behavior of limiter with 3 requests per 100ms
+func testRateLimiter(t *testing.T, limiter RateLimiter, sleep func(d time.Duration)) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	key := randomString()
+
+	_, err := limiter.Allow(ctx, "")
+	assert.Equal(ErrKeyIsNil, err)
+	_, err = limiter.AllowN(ctx, key, 0)
+	assert.Equal(ErrRateLimitCountInvalid, err)
+	_, err = limiter.AllowN(ctx, key, 4)
+	assert.Equal(ErrRateLimitCountInvalid, err)
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, key)
+		assert.Nil(err)
+		assert.True(result.Allowed)
+		assert.Equal(3, result.Limit)
+		assert.Equal(2-i, result.Remaining)
+		assert.Equal(time.Duration(0), result.RetryAfter)
+		assert.Greater(result.ResetAfter, time.Duration(0))
+		assert.LessOrEqual(result.ResetAfter, 200*time.Millisecond)
+	}
+	result, err := limiter.Allow(ctx, key)
+	assert.Nil(err)
+	assert.False(result.Allowed)
+	assert.Equal(0, result.Remaining)
+	assert.Greater(result.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(result.RetryAfter, 200*time.Millisecond)
+
+	// 等待后可再次请求
+	sleep(result.RetryAfter + time.Millisecond)
+	result, err = limiter.Allow(ctx, key)
+	assert.Nil(err)
+	assert.True(result.Allowed)
+
+	// 重置
+	assert.Nil(limiter.Reset(ctx, key))
+	result, err = limiter.AllowN(ctx, key, 3)
+	assert.Nil(err)
+	assert.True(result.Allowed)
+	assert.Equal(0, result.Remaining)
+}
+
+// newTestMemoryRateLimiter creates the memory limiter with a manual clock
+func newTestMemoryRateLimiter(algorithm RateLimitAlgorithm, limit RateLimit) (*memoryRateLimiter, func(d time.Duration)) {
+	l, _ := NewMemoryRateLimiter(algorithm, limit)
+	m := l.(*memoryRateLimiter)
+	now := time.Unix(1600000000, 0)
+	m.now = func() time.Time {
+		return now
+	}
+	return m, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewMemoryRateLimiter(0, RateLimit{Limit: 1, Period: time.Second})
+	assert.Equal(ErrRateLimitAlgorithmUnknown, err)
+	_, err = NewMemoryRateLimiter(RateLimitGCRA, RateLimit{Period: time.Second})
+	assert.Equal(ErrRateLimitInvalid, err)
+
+	for _, algorithm := range rateLimitAlgorithms {
+		m, sleep := newTestMemoryRateLimiter(algorithm, RateLimit{
+			Limit:  3,
+			Period: 100 * time.Millisecond,
+		})
+		testRateLimiter(t, m, sleep)
+	}
+}
+
+func TestMemoryRateLimiterAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	limit := RateLimit{
+		Limit:  10,
+		Period: time.Second,
+	}
+
+	// 固定窗口在窗口边缘允许两倍的请求
+	m, sleep := newTestMemoryRateLimiter(RateLimitFixedWindow, limit)
+	sleep(900 * time.Millisecond)
+	result, _ := m.AllowN(ctx, "a", 10)
+	assert.True(result.Allowed)
+	assert.Equal(100*time.Millisecond, result.ResetAfter)
+	sleep(100 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 10)
+	assert.True(result.Allowed)
+
+	// 滑动窗口日志精确限制
+	m, sleep = newTestMemoryRateLimiter(RateLimitSlidingWindowLog, limit)
+	sleep(900 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 5)
+	assert.True(result.Allowed)
+	sleep(50 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 5)
+	assert.True(result.Allowed)
+	sleep(100 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 6)
+	assert.False(result.Allowed)
+	assert.Equal(0, result.Remaining)
+	assert.Equal(900*time.Millisecond, result.RetryAfter)
+	assert.Equal(900*time.Millisecond, result.ResetAfter)
+	sleep(850 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 5)
+	assert.True(result.Allowed)
+
+	// 滑动窗口计数以上一窗口的权重估算
+	m, sleep = newTestMemoryRateLimiter(RateLimitSlidingWindowCounter, limit)
+	result, _ = m.AllowN(ctx, "a", 10)
+	assert.True(result.Allowed)
+	sleep(1250 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 3)
+	assert.False(result.Allowed)
+	assert.Equal(2, result.Remaining)
+	assert.Equal(50*time.Millisecond, result.RetryAfter)
+	result, _ = m.AllowN(ctx, "a", 2)
+	assert.True(result.Allowed)
+	assert.Equal(0, result.Remaining)
+
+	// 令牌桶按速率补充
+	m, sleep = newTestMemoryRateLimiter(RateLimitTokenBucket, RateLimit{
+		Limit:  10,
+		Period: time.Second,
+		Burst:  5,
+	})
+	result, _ = m.AllowN(ctx, "a", 5)
+	assert.True(result.Allowed)
+	assert.Equal(500*time.Millisecond, result.ResetAfter)
+	result, _ = m.AllowN(ctx, "a", 2)
+	assert.False(result.Allowed)
+	assert.Equal(200*time.Millisecond, result.RetryAfter)
+	sleep(250 * time.Millisecond)
+	result, _ = m.AllowN(ctx, "a", 2)
+	assert.True(result.Allowed)
+	assert.Equal(0, result.Remaining)
+
+	// GCRA均匀分布请求
+	m, sleep = newTestMemoryRateLimiter(RateLimitGCRA, RateLimit{
+		Limit:  10,
+		Period: time.Second,
+		Burst:  2,
+	})
+	result, _ = m.AllowN(ctx, "a", 2)
+	assert.True(result.Allowed)
+	assert.Equal(0, result.Remaining)
+	assert.Equal(200*time.Millisecond, result.ResetAfter)
+	result, _ = m.Allow(ctx, "a")
+	assert.False(result.Allowed)
+	assert.Equal(100*time.Millisecond, result.RetryAfter)
+	sleep(100 * time.Millisecond)
+	result, _ = m.Allow(ctx, "a")
+	assert.True(result.Allowed)
+	result, _ = m.Allow(ctx, "a")
+	assert.False(result.Allowed)
+
+	// 过期的数据被清除
+	sleep(time.Second)
+	_, _ = m.Allow(ctx, "b")
+	assert.Equal(1, len(m.entries))
+}
@@ -23,9 +23,11 @@ import (
 
 // RedisCache redis cache
 type RedisCache struct {
-	client redis.UniversalClient
-	ttl    time.Duration
-	prefix string
+	client    redis.UniversalClient
+	ttl       time.Duration
+	prefix    string
+	codec     Codec
+	encryptor *Encryptor
 }
 
 const defaultRedisTTL = 10 * time.Minute
@@ -53,6 +55,20 @@ func RedisCachePrefixOption(prefix string) RedisCacheOption {
 	}
 }
 
+// RedisCacheCodecOption set codec for struct functions of redis cache
+func RedisCacheCodecOption(codec Codec) RedisCacheOption {
+	return func(c *RedisCache) {
+		c.codec = codec
+	}
+}
+
+// RedisCacheEncryptorOption set encryptor for struct functions of redis cache
+func RedisCacheEncryptorOption(encryptor *Encryptor) RedisCacheOption {
+	return func(c *RedisCache) {
+		c.encryptor = encryptor
+	}
+}
+
 // NewRedisCache returns a new redis cache
 func NewRedisCache(c redis.UniversalClient, opts ...RedisCacheOption) *RedisCache {
 	rc := &RedisCache{
@@ -84,8 +100,23 @@ func (c *RedisCache) getKey(key string) (string, error) {
 	return c.prefix + key, nil
 }
 
-func (c *RedisCache) lock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
-	return c.client.SetNX(ctx, key, true, ttl).Result()
+// lock sets the key with a random token if it is not exists,
+// it returns nil if the lock is not obtained
+func (c *RedisCache) lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	success, err := c.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !success {
+		return nil, err
+	}
+	return &Lock{
+		client: c.client,
+		key:    key,
+		token:  token,
+		ttl:    ttl,
+	}, nil
 }
 
 // Lock the key for ttl, ii will return true, nil if success
@@ -95,7 +126,29 @@ func (c *RedisCache) Lock(ctx context.Context, key string, ttl ...time.Duration)
 		return false, err
 	}
 	d := c.getTTL(ttl...)
-	return c.lock(ctx, key, d)
+	l, err := c.lock(ctx, key, d)
+	if err != nil {
+		return false, err
+	}
+	return l != nil, nil
+}
+
+// TryLock locks the key for ttl and returns the lock, it returns
+// ErrLockNotObtained if the key is locked by others
+func (c *RedisCache) TryLock(ctx context.Context, key string, ttl ...time.Duration) (*Lock, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	d := c.getTTL(ttl...)
+	l, err := c.lock(ctx, key, d)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, ErrLockNotObtained
+	}
+	return l, nil
 }
 
 func (c *RedisCache) del(ctx context.Context, key string) (int64, error) {
@@ -112,20 +165,37 @@ func (c *RedisCache) Del(ctx context.Context, key string) (int64, error) {
 	return c.del(ctx, key)
 }
 
-// LockWithDone locks the key for ttl and return done function to delete the lock
+// TryLockWithWatchdog locks the key for ttl and refreshes the lease every ttl/3
+// in background until the lock is unlocked or the context is done. If the lease
+// is lost, the channel of Lock.Lost will be closed and onLost(can be nil) will be called.
+func (c *RedisCache) TryLockWithWatchdog(ctx context.Context, key string, onLost func(err error), ttl ...time.Duration) (*Lock, error) {
+	l, err := c.TryLock(ctx, key, ttl...)
+	if err != nil {
+		return nil, err
+	}
+	l.startWatchdog(ctx, onLost)
+	return l, nil
+}
+
+// LockWithDone locks the key for ttl and return done function to delete the lock,
+// the lock is deleted only if it is still owned
 func (c *RedisCache) LockWithDone(ctx context.Context, key string, ttl ...time.Duration) (bool, Done, error) {
 	key, err := c.getKey(key)
 	if err != nil {
 		return false, noop, err
 	}
 	d := c.getTTL(ttl...)
-	success, err := c.lock(ctx, key, d)
+	l, err := c.lock(ctx, key, d)
 	// 如果lock失败，则返回no op 的done function
-	if err != nil || !success {
+	if err != nil || l == nil {
 		return false, noop, err
 	}
 	done := func() error {
-		_, err := c.del(ctx, key)
+		err := l.Unlock(ctx)
+		// 锁已过期或被其它实例获取，无需删除
+		if err == ErrLockNotHeld {
+			return nil
+		}
 		return err
 	}
 	return true, done, nil
@@ -217,6 +287,30 @@ func (c *RedisCache) Set(ctx context.Context, key string, value any, ttl ...time
 	return c.set(ctx, key, value, d)
 }
 
+// marshalStruct marshals the value with codec and encrypts it
+func (c *RedisCache) marshalStruct(key string, value any) ([]byte, error) {
+	buf, err := marshalWithCodec(c.codec, value)
+	if err != nil {
+		return nil, err
+	}
+	if c.encryptor == nil {
+		return buf, nil
+	}
+	return c.encryptor.Encrypt(buf, []byte(key))
+}
+
+// unmarshalStruct decrypts the data and unmarshals it with codec
+func (c *RedisCache) unmarshalStruct(key string, data []byte, value any) error {
+	if c.encryptor != nil {
+		buf, err := c.encryptor.Decrypt(data, []byte(key))
+		if err != nil {
+			return err
+		}
+		data = buf
+	}
+	return unmarshalWithCodec(c.codec, data, value)
+}
+
 func (c *RedisCache) getStruct(ctx context.Context, key string, value any) error {
 	key, err := c.getKey(key)
 	if err != nil {
@@ -227,7 +321,7 @@ func (c *RedisCache) getStruct(ctx context.Context, key string, value any) error
 	if err != nil {
 		return err
 	}
-	return unmarshal(result, value)
+	return c.unmarshalStruct(key, result, value)
 }
 
 // GetStruct gets cache and unmarshal to struct
@@ -245,7 +339,7 @@ func (c *RedisCache) GetStructAndTTL(ctx context.Context, key string, value any)
 	if err != nil {
 		return 0, err
 	}
-	err = unmarshal(buf[timestampByteSize:], value)
+	err = c.unmarshalStruct(key, buf[timestampByteSize:], value)
 	if err != nil {
 		return 0, err
 	}
@@ -276,7 +370,7 @@ func (c *RedisCache) setStruct(ctx context.Context, key string, value any, ttl .
 	if err != nil {
 		return err
 	}
-	buf, err := marshal(value)
+	buf, err := c.marshalStruct(key, value)
 	if err != nil {
 		return err
 	}
@@ -295,7 +389,7 @@ func (c *RedisCache) SetStructWithTTL(ctx context.Context, key string, value any
 	if err != nil {
 		return err
 	}
-	buf, err := marshal(value)
+	buf, err := c.marshalStruct(key, value)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,184 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrCounterBelowFloor = errors.New("Counter below floor")
+
+// 减少计数：结果小于下限时不修改并返回{0, 当前值}，首次写入时设置ttl
+var decWithFloorScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+local current = tonumber(value or "0")
+local result = current - tonumber(ARGV[1])
+if result < tonumber(ARGV[2]) then
+	return {0, current}
+end
+if not value then
+	redis.call("SET", KEYS[1], "0", "PX", ARGV[3])
+end
+return {1, redis.call("DECRBY", KEYS[1], ARGV[1])}
+`)
+
+// 增加计数，首次写入时设置ttl
+var incWithTTLScript = redis.NewScript(`
+redis.call("SET", KEYS[1], "0", "PX", ARGV[2], "NX")
+return redis.call("INCRBY", KEYS[1], ARGV[1])
+`)
+
+// 获取并重置计数为0，保留原有的ttl
+var getAndResetScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if not value then
+	return false
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], "0", "PX", ttl)
+else
+	redis.call("SET", KEYS[1], "0")
+end
+return value
+`)
+
+// DecWithFloor decreases the value of key if the result is not less than floor,
+// otherwise it returns the current value and ErrCounterBelowFloor. The ttl is set
+// only if the key is not exists.
+func (c *RedisCache) DecWithFloor(ctx context.Context, key string, value, floor int64, ttl ...time.Duration) (int64, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return 0, err
+	}
+	d := c.getTTL(ttl...)
+	result, err := decWithFloorScript.Run(ctx, c.client, []string{key}, value, floor, d.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, err
+	}
+	if result[0] == 0 {
+		return result[1], ErrCounterBelowFloor
+	}
+	return result[1], nil
+}
+
+// IncFloatWith inc the float value of key from cache, the ttl is set only if the key is not exists
+func (c *RedisCache) IncFloatWith(ctx context.Context, key string, value float64, ttl ...time.Duration) (float64, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return 0, err
+	}
+	pipe := c.txPipeline()
+	d := c.getTTL(ttl...)
+	pipe.SetNX(ctx, key, 0, d)
+	incr := pipe.IncrByFloat(ctx, key, value)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// IncBatch inc the values of keys in one pipeline, the ttl is set only if the
+// key is not exists. The increment of each key is atomic, but the increments
+// of different keys are not.
+func (c *RedisCache) IncBatch(ctx context.Context, values map[string]int64, ttl ...time.Duration) (map[string]int64, error) {
+	if len(values) == 0 {
+		return map[string]int64{}, nil
+	}
+	pending := make(map[string]string, len(values))
+	for key := range values {
+		k, err := c.getKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pending[key] = k
+	}
+	// 不足1毫秒的ttl按1毫秒处理，避免PX 0出错
+	ms := c.getTTL(ttl...).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	result := make(map[string]int64, len(values))
+	for loaded := false; ; loaded = true {
+		// 每个key通过脚本执行，保证设置ttl与增加计数的原子性，且支持cluster
+		pipe := c.client.Pipeline()
+		cmds := make(map[string]*redis.Cmd, len(pending))
+		for key, k := range pending {
+			cmds[key] = incWithTTLScript.EvalSha(ctx, pipe, []string{k}, values[key], ms)
+		}
+		// 出错在各命令的结果中处理
+		_, _ = pipe.Exec(ctx)
+		missing := make(map[string]string)
+		for key, cmd := range cmds {
+			count, err := cmd.Int64()
+			// 脚本未加载的key在加载后重新执行，已执行的key不可重复执行
+			if err != nil && !loaded && redis.HasErrorPrefix(err, "NOSCRIPT") {
+				missing[key] = pending[key]
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			result[key] = count
+		}
+		if len(missing) == 0 {
+			return result, nil
+		}
+		err := incWithTTLScript.Load(ctx, c.client).Err()
+		if err != nil {
+			return nil, err
+		}
+		pending = missing
+	}
+}
+
+// getAndReset gets the value of key and resets it to 0, it returns
+// an empty string if the key is not exists
+func (c *RedisCache) getAndReset(ctx context.Context, key string) (string, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return "", err
+	}
+	value, err := getAndResetScript.Run(ctx, c.client, []string{key}).Text()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// GetAndReset gets the value of counter and resets it to 0 with the ttl kept,
+// it is used for flushing the counter periodically. It returns 0 if the key is not exists.
+func (c *RedisCache) GetAndReset(ctx context.Context, key string) (int64, error) {
+	value, err := c.getAndReset(ctx, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// GetFloatAndReset gets the float value of counter and resets it to 0 with the ttl kept
+func (c *RedisCache) GetFloatAndReset(ctx context.Context, key string) (float64, error) {
+	value, err := c.getAndReset(ctx, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
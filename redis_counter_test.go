@@ -0,0 +1,195 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisDecWithFloor(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	// 不存在时当作0
+	count, err := srv.DecWithFloor(ctx, key, 1, 0, time.Minute)
+	assert.Equal(ErrCounterBelowFloor, err)
+	assert.Equal(int64(0), count)
+
+	count, err = srv.IncWith(ctx, key, 10, time.Minute)
+	assert.Nil(err)
+	assert.Equal(int64(10), count)
+	count, err = srv.DecWithFloor(ctx, key, 4, 0)
+	assert.Nil(err)
+	assert.Equal(int64(6), count)
+	count, err = srv.DecWithFloor(ctx, key, 7, 0)
+	assert.Equal(ErrCounterBelowFloor, err)
+	assert.Equal(int64(6), count)
+
+	// 并发扣减不会小于下限
+	var success int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := srv.DecWithFloor(ctx, key, 1, 0)
+			if err == nil {
+				atomic.AddInt32(&success, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int32(6), success)
+	count, err = srv.GetAndReset(ctx, key)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	// 首次写入时设置ttl
+	key = randomString()
+	count, err = srv.DecWithFloor(ctx, key, 2, -5, time.Minute)
+	assert.Nil(err)
+	assert.Equal(int64(-2), count)
+	ttl, err := srv.TTL(ctx, key)
+	assert.Nil(err)
+	assert.Greater(ttl, 50*time.Second)
+}
+
+func TestRedisIncFloatWith(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	value, err := srv.IncFloatWith(ctx, key, 1.5, time.Minute)
+	assert.Nil(err)
+	assert.Equal(1.5, value)
+	value, err = srv.IncFloatWith(ctx, key, 0.25)
+	assert.Nil(err)
+	assert.Equal(1.75, value)
+
+	value, err = srv.GetFloatAndReset(ctx, key)
+	assert.Nil(err)
+	assert.Equal(1.75, value)
+	value, err = srv.IncFloatWith(ctx, key, 1)
+	assert.Nil(err)
+	assert.Equal(1.0, value)
+}
+
+func TestRedisIncBatch(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key1 := randomString()
+	key2 := randomString()
+
+	result, err := srv.IncBatch(ctx, nil)
+	assert.Nil(err)
+	assert.Empty(result)
+	_, err = srv.IncBatch(ctx, map[string]int64{
+		"": 1,
+	})
+	assert.Equal(ErrKeyIsNil, err)
+
+	result, err = srv.IncBatch(ctx, map[string]int64{
+		key1: 1,
+		key2: 2,
+	}, time.Minute)
+	assert.Nil(err)
+	assert.Equal(map[string]int64{
+		key1: 1,
+		key2: 2,
+	}, result)
+	result, err = srv.IncBatch(ctx, map[string]int64{
+		key1: 3,
+		key2: -1,
+	})
+	assert.Nil(err)
+	assert.Equal(map[string]int64{
+		key1: 4,
+		key2: 1,
+	}, result)
+
+	// 首次写入时设置ttl
+	for _, key := range []string{key1, key2} {
+		ttl, err := srv.TTL(ctx, key)
+		assert.Nil(err)
+		assert.Greater(ttl, 50*time.Second)
+	}
+
+	// 脚本未加载时加载后再执行
+	err = c.ScriptFlush(ctx).Err()
+	assert.Nil(err)
+	result, err = srv.IncBatch(ctx, map[string]int64{
+		key1: 1,
+		key2: 1,
+	})
+	assert.Nil(err)
+	assert.Equal(map[string]int64{
+		key1: 5,
+		key2: 2,
+	}, result)
+
+	// 不足1毫秒的ttl
+	key3 := randomString()
+	result, err = srv.IncBatch(ctx, map[string]int64{
+		key3: 1,
+	}, time.Microsecond)
+	assert.Nil(err)
+	assert.Equal(map[string]int64{
+		key3: 1,
+	}, result)
+}
+
+func TestRedisGetAndReset(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	// 不存在时返回0
+	count, err := srv.GetAndReset(ctx, key)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	_, err = srv.IncWith(ctx, key, 5, time.Minute)
+	assert.Nil(err)
+	count, err = srv.GetAndReset(ctx, key)
+	assert.Nil(err)
+	assert.Equal(int64(5), count)
+	count, err = srv.IncWith(ctx, key, 1)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+
+	// 重置后保留ttl
+	ttl, err := srv.TTL(ctx, key)
+	assert.Nil(err)
+	assert.Greater(ttl, 50*time.Second)
+}
@@ -0,0 +1,194 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLockNotObtained = errors.New("Lock not obtained")
+var ErrLockNotHeld = errors.New("Lock not held")
+
+// 仅在token相同时删除，避免删除其它实例获取的锁，
+// 删除后发布释放的消息，用于唤醒等待者
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	redis.call("PUBLISH", ARGV[2], "1")
+	return 1
+end
+return 0
+`)
+
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var lockTTLScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PTTL", KEYS[1])
+end
+return -3
+`)
+
+// Lock is the lock of redis, the value of key is a random token,
+// so it can only be released or refreshed by the owner
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+
+	// stop and lost are created only if the watchdog is started
+	stopOnce sync.Once
+	stop     chan struct{}
+	lost     chan struct{}
+}
+
+// startWatchdog refreshes the lease every ttl/3 in background until
+// the lock is unlocked or the context is done. The lost channel will be
+// closed and onLost will be called if the lease is lost.
+func (l *Lock) startWatchdog(ctx context.Context, onLost func(err error)) {
+	l.stop = make(chan struct{})
+	l.lost = make(chan struct{})
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		refreshedAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.stop:
+				return
+			case <-ticker.C:
+			}
+			err := l.Refresh(ctx)
+			if err == nil {
+				refreshedAt = time.Now()
+				continue
+			}
+			// 其它出错(如网络异常)，在租约过期前重试
+			if err != ErrLockNotHeld && time.Since(refreshedAt) < l.ttl {
+				continue
+			}
+			// 已unlock或context已取消，非租约丢失
+			select {
+			case <-l.stop:
+				return
+			case <-ctx.Done():
+				return
+			default:
+			}
+			close(l.lost)
+			if onLost != nil {
+				onLost(err)
+			}
+			return
+		}
+	}()
+}
+
+func (l *Lock) stopWatchdog() {
+	if l.stop == nil {
+		return
+	}
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+// Lost returns the channel which is closed if the lease is lost,
+// it returns nil(blocks forever) if the watchdog is not started
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Key returns the key of lock(with prefix)
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the owner token of lock
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Unlock deletes the lock, it returns ErrLockNotHeld if
+// the lock is expired or obtained by others
+func (l *Lock) Unlock(ctx context.Context) error {
+	// 先停止续期，避免删除后被判断为租约丢失
+	l.stopWatchdog()
+	count, err := unlockScript.Run(ctx, l.client, []string{
+		l.key,
+	}, l.token, lockReleasedChannel(l.key)).Int()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// TTL returns the ttl of lock, it returns ErrLockNotHeld if
+// the lock is expired or obtained by others
+func (l *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	ms, err := lockTTLScript.Run(ctx, l.client, []string{
+		l.key,
+	}, l.token).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if ms == -3 {
+		return 0, ErrLockNotHeld
+	}
+	// 无过期时间
+	if ms < 0 {
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Refresh resets the ttl of lock, the ttl of lock creation will be used
+// if ttl is nil. It returns ErrLockNotHeld if the lock is expired or obtained by others
+func (l *Lock) Refresh(ctx context.Context, ttl ...time.Duration) error {
+	d := l.ttl
+	if len(ttl) != 0 {
+		d = ttl[0]
+	}
+	count, err := refreshScript.Run(ctx, l.client, []string{
+		l.key,
+	}, l.token, d.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 锁为hash，记录owner与持有的次数，相同的owner可多次获取
+var reentrantLockScript = redis.NewScript(`
+local owner = redis.call("HGET", KEYS[1], "owner")
+if owner == false then
+	redis.call("HSET", KEYS[1], "owner", ARGV[1], "count", 1)
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if owner == ARGV[1] then
+	local count = redis.call("HINCRBY", KEYS[1], "count", 1)
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return count
+end
+return 0
+`)
+
+// 持有的次数减1，为0时删除锁
+var reentrantUnlockScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "owner") ~= ARGV[1] then
+	return -1
+end
+local count = redis.call("HINCRBY", KEYS[1], "count", -1)
+if count <= 0 then
+	redis.call("DEL", KEYS[1])
+	redis.call("PUBLISH", ARGV[2], "1")
+	return 0
+end
+return count
+`)
+
+// ReentrantLock is the reentrant lock of redis, it can be obtained
+// many times by the same owner, and it is released after the
+// same times of unlock
+type ReentrantLock struct {
+	client redis.UniversalClient
+	key    string
+	owner  string
+	ttl    time.Duration
+}
+
+// NewReentrantLock creates a reentrant lock of key, a random owner will be used
+// if owner is empty. The lock should be passed to the code path which re-enters
+// the locked section, or created with the same owner.
+func (c *RedisCache) NewReentrantLock(key, owner string, ttl ...time.Duration) (*ReentrantLock, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" {
+		owner, err = newRandomID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ReentrantLock{
+		client: c.client,
+		key:    key,
+		owner:  owner,
+		ttl:    c.getTTL(ttl...),
+	}, nil
+}
+
+// Owner returns the owner of lock
+func (l *ReentrantLock) Owner() string {
+	return l.owner
+}
+
+// Lock obtains the lock and resets the ttl, it returns the hold count of lock.
+// It returns ErrLockNotObtained if the lock is held by other owner
+func (l *ReentrantLock) Lock(ctx context.Context) (int64, error) {
+	count, err := reentrantLockScript.Run(ctx, l.client, []string{
+		l.key,
+	}, l.owner, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrLockNotObtained
+	}
+	return count, nil
+}
+
+// Unlock decreases the hold count of lock, the lock is deleted if the count is 0.
+// It returns the remaining hold count, and ErrLockNotHeld if the lock
+// is expired or held by other owner
+func (l *ReentrantLock) Unlock(ctx context.Context) (int64, error) {
+	count, err := reentrantUnlockScript.Run(ctx, l.client, []string{
+		l.key,
+	}, l.owner, lockReleasedChannel(l.key)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, ErrLockNotHeld
+	}
+	return count, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisReentrantLock(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c, RedisCachePrefixOption("prefix:"))
+	ctx := context.Background()
+	key := randomString()
+
+	l, err := srv.NewReentrantLock(key, "", time.Second)
+	assert.Nil(err)
+	assert.NotEmpty(l.Owner())
+	other, err := srv.NewReentrantLock(key, "other", time.Second)
+	assert.Nil(err)
+	assert.Equal("other", other.Owner())
+
+	// 相同owner可多次获取
+	count, err := l.Lock(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	count, err = l.Lock(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(2), count)
+	same, err := srv.NewReentrantLock(key, l.Owner(), time.Second)
+	assert.Nil(err)
+	count, err = same.Lock(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(3), count)
+
+	_, err = other.Lock(ctx)
+	assert.Equal(ErrLockNotObtained, err)
+	_, err = other.Unlock(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+
+	// 释放相同次数后删除
+	for _, remaining := range []int64{2, 1, 0} {
+		count, err = l.Unlock(ctx)
+		assert.Nil(err)
+		assert.Equal(remaining, count)
+	}
+	_, err = l.Unlock(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	count, err = other.Lock(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+
+	// 过期后可由其它owner获取
+	key = randomString()
+	l, err = srv.NewReentrantLock(key, "", 10*time.Millisecond)
+	assert.Nil(err)
+	_, err = l.Lock(ctx)
+	assert.Nil(err)
+	time.Sleep(20 * time.Millisecond)
+	other, err = srv.NewReentrantLock(key, "other", time.Second)
+	assert.Nil(err)
+	_, err = other.Lock(ctx)
+	assert.Nil(err)
+
+	_, err = srv.NewReentrantLock("", "")
+	assert.Equal(ErrKeyIsNil, err)
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisTryLock(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c, RedisCachePrefixOption("prefix:"))
+	ctx := context.Background()
+	key := randomString()
+
+	l, err := srv.TryLock(ctx, key, time.Second)
+	assert.Nil(err)
+	assert.Equal("prefix:"+key, l.Key())
+	assert.NotEmpty(l.Token())
+	token, err := c.Get(ctx, l.Key()).Result()
+	assert.Nil(err)
+	assert.Equal(l.Token(), token)
+
+	_, err = srv.TryLock(ctx, key, time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+
+	ttl, err := l.TTL(ctx)
+	assert.Nil(err)
+	assert.True(ttl > 0 && ttl <= time.Second)
+
+	err = l.Refresh(ctx, time.Minute)
+	assert.Nil(err)
+	ttl, err = l.TTL(ctx)
+	assert.Nil(err)
+	assert.True(ttl > time.Second)
+	// 使用创建时的ttl
+	err = l.Refresh(ctx)
+	assert.Nil(err)
+	ttl, err = l.TTL(ctx)
+	assert.Nil(err)
+	assert.True(ttl <= time.Second)
+
+	err = l.Unlock(ctx)
+	assert.Nil(err)
+	err = l.Unlock(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	err = l.Refresh(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	_, err = l.TTL(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+
+	_, err = srv.TryLock(ctx, "")
+	assert.Equal(ErrKeyIsNil, err)
+}
+
+func TestRedisLockOwnership(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	// 锁已过期，且被其它实例获取
+	l, err := srv.TryLock(ctx, key, 10*time.Millisecond)
+	assert.Nil(err)
+	time.Sleep(20 * time.Millisecond)
+	other, err := srv.TryLock(ctx, key, time.Second)
+	assert.Nil(err)
+
+	// 无法删除与刷新其它实例的锁
+	err = l.Unlock(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	err = l.Refresh(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	_, err = srv.TryLock(ctx, key)
+	assert.Equal(ErrLockNotObtained, err)
+	err = other.Unlock(ctx)
+	assert.Nil(err)
+
+	// done仅删除自己的锁
+	ok, done, err := srv.LockWithDone(ctx, key, 10*time.Millisecond)
+	assert.Nil(err)
+	assert.True(ok)
+	time.Sleep(20 * time.Millisecond)
+	other, err = srv.TryLock(ctx, key, time.Second)
+	assert.Nil(err)
+	err = done()
+	assert.Nil(err)
+	_, err = other.TTL(ctx)
+	assert.Nil(err)
+}
+
+func TestRedisLockWatchdog(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	ttl := 60 * time.Millisecond
+
+	// 自动续期，超过ttl后仍持有锁
+	key := randomString()
+	l, err := srv.TryLockWithWatchdog(ctx, key, nil, ttl)
+	assert.Nil(err)
+	time.Sleep(3 * ttl)
+	_, err = l.TTL(ctx)
+	assert.Nil(err)
+	select {
+	case <-l.Lost():
+		assert.Fail("lease should not be lost")
+	default:
+	}
+	err = l.Unlock(ctx)
+	assert.Nil(err)
+	time.Sleep(ttl)
+	select {
+	case <-l.Lost():
+		assert.Fail("lease should not be lost after unlock")
+	default:
+	}
+
+	// 锁被删除，租约丢失
+	key = randomString()
+	errs := make(chan error, 1)
+	l, err = srv.TryLockWithWatchdog(ctx, key, func(err error) {
+		errs <- err
+	}, ttl)
+	assert.Nil(err)
+	_, err = srv.Del(ctx, key)
+	assert.Nil(err)
+	select {
+	case <-l.Lost():
+	case <-time.After(3 * ttl):
+		assert.Fail("lease should be lost")
+	}
+	assert.Equal(ErrLockNotHeld, <-errs)
+
+	// context取消后停止续期
+	key = randomString()
+	cancelCtx, cancel := context.WithCancel(ctx)
+	l, err = srv.TryLockWithWatchdog(cancelCtx, key, nil, ttl)
+	assert.Nil(err)
+	cancel()
+	time.Sleep(2 * ttl)
+	_, err = l.TTL(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	select {
+	case <-l.Lost():
+		assert.Fail("lease should not be lost after cancel")
+	default:
+	}
+
+	// 未启用watchdog
+	l, err = srv.TryLock(ctx, randomString(), ttl)
+	assert.Nil(err)
+	assert.Nil(l.Lost())
+	assert.Nil(l.Unlock(ctx))
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultLockRetryDelay   = 50 * time.Millisecond
+	defaultLockQueueTimeout = 5 * time.Second
+)
+
+// RetryStrategy returns the delay before the next attempt, the attempt starts from 0
+type RetryStrategy func(attempt int) time.Duration
+
+// NewFixedRetry creates a retry strategy with fixed delay
+func NewFixedRetry(delay time.Duration) RetryStrategy {
+	return func(_ int) time.Duration {
+		return delay
+	}
+}
+
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{
+	Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// NewExponentialRetry creates a retry strategy with exponential delay, the delay
+// is base*2^attempt and capped by max, and the jitter is random in [delay/2, delay]
+func NewExponentialRetry(base, max time.Duration) RetryStrategy {
+	return func(attempt int) time.Duration {
+		delay := max
+		// 避免溢出
+		if attempt < 32 {
+			if d := base << uint(attempt); d > 0 && d < max {
+				delay = d
+			}
+		}
+		half := int64(delay / 2)
+		if half <= 0 {
+			return delay
+		}
+		jitterRand.Lock()
+		defer jitterRand.Unlock()
+		return time.Duration(half + jitterRand.Int63n(half+1))
+	}
+}
+
+// LockWaitOption is the option of LockWait
+type LockWaitOption struct {
+	// Retry is the retry strategy, the fixed delay of 50ms is used if it is nil
+	Retry RetryStrategy
+	// MaxWait is the max duration of waiting, ErrLockNotObtained will be
+	// returned if it is exceeded. The deadline of context is used if it is 0
+	MaxWait time.Duration
+	// Fair makes the waiters obtain the lock in the order of arrival,
+	// the queue is saved as "key:queue" and "key:queue:alive", so the key
+	// should have hash tag for redis cluster
+	Fair bool
+	// QueueTimeout is the duration after which a waiter that has not retried is
+	// removed from the queue, the retry delay is capped by QueueTimeout/3. Default is 5s
+	QueueTimeout time.Duration
+	// Notify subscribes the release signal of lock to wake the waiters instead of polling only
+	Notify bool
+}
+
+// lockReleasedChannel returns the pub/sub channel of lock release
+func lockReleasedChannel(key string) string {
+	return key + ":released"
+}
+
+// 公平锁，仅队列的第一个等待者可获取锁，并清除已失效的等待者
+var fairLockScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local timeout = tonumber(ARGV[3])
+redis.call("ZADD", KEYS[2], "NX", now, ARGV[1])
+redis.call("HSET", KEYS[3], ARGV[1], now + timeout)
+redis.call("PEXPIRE", KEYS[2], timeout * 2)
+redis.call("PEXPIRE", KEYS[3], timeout * 2)
+while true do
+	local head = redis.call("ZRANGE", KEYS[2], 0, 0)
+	if #head == 0 then
+		break
+	end
+	local expiredAt = tonumber(redis.call("HGET", KEYS[3], head[1]))
+	if expiredAt ~= nil and expiredAt >= now then
+		if head[1] ~= ARGV[1] then
+			return 0
+		end
+		break
+	end
+	redis.call("ZREM", KEYS[2], head[1])
+	redis.call("HDEL", KEYS[3], head[1])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	redis.call("ZREM", KEYS[2], ARGV[1])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// lockWaiter is the waiter of LockWait
+type lockWaiter struct {
+	client       redis.UniversalClient
+	key          string
+	token        string
+	ttl          time.Duration
+	fair         bool
+	queueTimeout time.Duration
+}
+
+func (w *lockWaiter) queueKeys() []string {
+	return []string{
+		w.key,
+		w.key + ":queue",
+		w.key + ":queue:alive",
+	}
+}
+
+func (w *lockWaiter) acquire(ctx context.Context) (bool, error) {
+	if !w.fair {
+		return w.client.SetNX(ctx, w.key, w.token, w.ttl).Result()
+	}
+	count, err := fairLockScript.Run(ctx, w.client, w.queueKeys(), w.token, w.ttl.Milliseconds(), w.queueTimeout.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// leave removes the waiter from the queue, it uses a new context
+// as the context of LockWait may be done
+func (w *lockWaiter) leave() {
+	if !w.fair {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	keys := w.queueKeys()
+	pipe := w.client.Pipeline()
+	pipe.ZRem(ctx, keys[1], w.token)
+	pipe.HDel(ctx, keys[2], w.token)
+	// 删除失败则忽略，由其它等待者清除
+	_, _ = pipe.Exec(ctx)
+}
+
+// LockWait waits until the lock is obtained or the max wait is exceeded, it returns
+// ErrLockNotObtained if the max wait is exceeded, and the error of context if the
+// context is done. The ttl of RedisCache is used if ttl is 0.
+func (c *RedisCache) LockWait(ctx context.Context, key string, ttl time.Duration, opt LockWaitOption) (*Lock, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = c.getTTL()
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	retry := opt.Retry
+	if retry == nil {
+		retry = NewFixedRetry(defaultLockRetryDelay)
+	}
+	queueTimeout := opt.QueueTimeout
+	if queueTimeout <= 0 {
+		queueTimeout = defaultLockQueueTimeout
+	}
+	w := &lockWaiter{
+		client:       c.client,
+		key:          key,
+		token:        token,
+		ttl:          ttl,
+		fair:         opt.Fair,
+		queueTimeout: queueTimeout,
+	}
+
+	waitCtx := ctx
+	if opt.MaxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, opt.MaxWait)
+		defer cancel()
+	}
+
+	var released <-chan *redis.Message
+	if opt.Notify {
+		pubsub := c.client.Subscribe(waitCtx, lockReleasedChannel(key))
+		defer pubsub.Close()
+		// 等待订阅成功，避免错过释放的消息
+		_, err = pubsub.Receive(waitCtx)
+		if err != nil {
+			return nil, c.lockWaitError(ctx, err)
+		}
+		released = pubsub.Channel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		success, err := w.acquire(waitCtx)
+		if err != nil {
+			w.leave()
+			return nil, c.lockWaitError(ctx, err)
+		}
+		if success {
+			return &Lock{
+				client: c.client,
+				key:    key,
+				token:  token,
+				ttl:    ttl,
+			}, nil
+		}
+		delay := retry(attempt)
+		// 公平锁需要在等待者失效前重试
+		if w.fair && delay > queueTimeout/3 {
+			delay = queueTimeout / 3
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			w.leave()
+			return nil, c.lockWaitError(ctx, waitCtx.Err())
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// lockWaitError returns the error of context if it is done,
+// and ErrLockNotObtained if the max wait is exceeded
+func (c *RedisCache) lockWaitError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ErrLockNotObtained
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryStrategy(t *testing.T) {
+	assert := assert.New(t)
+
+	fixed := NewFixedRetry(10 * time.Millisecond)
+	assert.Equal(10*time.Millisecond, fixed(0))
+	assert.Equal(10*time.Millisecond, fixed(10))
+
+	exponential := NewExponentialRetry(10*time.Millisecond, time.Second)
+	for attempt, max := range []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+	} {
+		delay := exponential(attempt)
+		assert.True(delay >= max/2 && delay <= max)
+	}
+	delay := exponential(100)
+	assert.True(delay >= 500*time.Millisecond && delay <= time.Second)
+}
+
+func TestRedisLockWait(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	l, err := srv.LockWait(ctx, key, time.Second, LockWaitOption{})
+	assert.Nil(err)
+
+	// 超过最大等待时长
+	start := time.Now()
+	_, err = srv.LockWait(ctx, key, time.Second, LockWaitOption{
+		Retry:   NewExponentialRetry(5*time.Millisecond, 20*time.Millisecond),
+		MaxWait: 50 * time.Millisecond,
+	})
+	assert.Equal(ErrLockNotObtained, err)
+	assert.True(time.Since(start) < 500*time.Millisecond)
+
+	// context取消
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = srv.LockWait(cancelCtx, key, time.Second, LockWaitOption{})
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// 释放后通过订阅唤醒，无需等待重试间隔
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = l.Unlock(ctx)
+	}()
+	start = time.Now()
+	l, err = srv.LockWait(ctx, key, time.Second, LockWaitOption{
+		Retry:  NewFixedRetry(5 * time.Second),
+		Notify: true,
+	})
+	assert.Nil(err)
+	assert.True(time.Since(start) < 2*time.Second)
+	assert.Nil(l.Unlock(ctx))
+
+	_, err = srv.LockWait(ctx, "", time.Second, LockWaitOption{})
+	assert.Equal(ErrKeyIsNil, err)
+}
+
+func TestRedisLockWaitFair(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+	key := randomString()
+
+	// 已失效的等待者被清除
+	err := c.ZAdd(ctx, key+":queue", redis.Z{
+		Score:  1,
+		Member: "stale",
+	}).Err()
+	assert.Nil(err)
+	l, err := srv.LockWait(ctx, key, time.Second, LockWaitOption{
+		Fair:    true,
+		MaxWait: time.Second,
+	})
+	assert.Nil(err)
+
+	// 按等待的顺序获取锁
+	order := make(chan string, 2)
+	wait := func(name string) {
+		l, err := srv.LockWait(ctx, key, time.Second, LockWaitOption{
+			Retry:   NewFixedRetry(5 * time.Millisecond),
+			Fair:    true,
+			Notify:  true,
+			MaxWait: 2 * time.Second,
+		})
+		if err != nil {
+			order <- err.Error()
+			return
+		}
+		order <- name
+		time.Sleep(20 * time.Millisecond)
+		_ = l.Unlock(ctx)
+	}
+	go wait("first")
+	time.Sleep(30 * time.Millisecond)
+	go wait("second")
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(l.Unlock(ctx))
+	assert.Equal("first", <-order)
+	assert.Equal("second", <-order)
+
+	// 放弃等待后从队列中删除
+	l, err = srv.LockWait(ctx, key, time.Second, LockWaitOption{
+		Fair: true,
+	})
+	assert.Nil(err)
+	_, err = srv.LockWait(ctx, key, time.Second, LockWaitOption{
+		Fair:    true,
+		MaxWait: 20 * time.Millisecond,
+	})
+	assert.Equal(ErrLockNotObtained, err)
+	count, err := c.ZCard(ctx, key+":queue").Result()
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	assert.Nil(l.Unlock(ctx))
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 所有脚本的参数为：period(微秒), limit, burst, n, token
+// 返回：{是否允许, 剩余数量, 重试等待(微秒), 重置等待(微秒)}
+const rateLimitScriptHeader = `
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local period = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+-- 避免数值转换为字符串时(%.14g)丢失精度
+local function num(value)
+	return string.format("%.17g", value)
+end
+local function expire(ttl)
+	redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil(ttl / 1000)))
+end
+`
+
+// 固定窗口：记录窗口序号与计数
+var rateLimitFixedWindowScript = redis.NewScript(rateLimitScriptHeader + `
+local window = math.floor(now / period)
+local data = redis.call("HMGET", KEYS[1], "window", "count")
+local count = 0
+if tonumber(data[1]) == window then
+	count = tonumber(data[2])
+end
+local reset = math.ceil((window + 1) * period) - now
+if count + n > limit then
+	return {0, limit - count, reset, reset}
+end
+count = count + n
+redis.call("HSET", KEYS[1], "window", num(window), "count", count)
+expire(reset)
+return {1, limit - count, 0, reset}
+`)
+
+// 滑动窗口日志：有序集合记录每次请求的时间
+var rateLimitSlidingWindowLogScript = redis.NewScript(rateLimitScriptHeader + `
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", num(now - period))
+local count = redis.call("ZCARD", KEYS[1])
+if count + n > limit then
+	local index = count + n - limit - 1
+	local oldest = redis.call("ZRANGE", KEYS[1], index, index, "WITHSCORES")
+	local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	return {0, limit - count, tonumber(oldest[2]) + period - now, tonumber(newest[2]) + period - now}
+end
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], num(now), ARGV[5] .. ":" .. i)
+end
+expire(period)
+return {1, limit - count - n, 0, period}
+`)
+
+// 滑动窗口计数：以上一窗口的加权计数估算滑动窗口内的数量
+var rateLimitSlidingWindowCounterScript = redis.NewScript(rateLimitScriptHeader + `
+local window = math.floor(now / period)
+local data = redis.call("HMGET", KEYS[1], "window", "count", "prev")
+local count = 0
+local prev = 0
+local current = tonumber(data[1])
+if current == window then
+	count = tonumber(data[2])
+	prev = tonumber(data[3])
+elseif current == window - 1 then
+	prev = tonumber(data[2])
+end
+local elapsed = now - window * period
+local estimate = prev * (period - elapsed) / period + count
+if estimate + n > limit then
+	local retry
+	if count + n <= limit then
+		retry = period * (prev - (limit - count - n)) / prev - elapsed
+	else
+		retry = period - elapsed
+		if count > limit - n then
+			retry = retry + period * (count - (limit - n)) / count
+		end
+	end
+	local reset = period - elapsed
+	if count > 0 then
+		reset = reset + period
+	end
+	return {0, math.floor(limit - estimate), math.ceil(retry), math.ceil(reset)}
+end
+redis.call("HSET", KEYS[1], "window", num(window), "count", num(count + n), "prev", num(prev))
+local reset = math.ceil(2 * period - elapsed)
+expire(reset)
+return {1, math.floor(limit - estimate - n), 0, reset}
+`)
+
+// 令牌桶：记录剩余令牌数与更新时间
+var rateLimitTokenBucketScript = redis.NewScript(rateLimitScriptHeader + `
+local rate = limit / period
+local data = redis.call("HMGET", KEYS[1], "tokens", "updatedAt")
+local tokens = burst
+if data[1] then
+	tokens = math.min(burst, tonumber(data[1]) + (now - tonumber(data[2])) * rate)
+end
+if tokens < n then
+	return {0, math.floor(tokens), math.ceil((n - tokens) / rate), math.ceil((burst - tokens) / rate)}
+end
+tokens = tokens - n
+local reset = math.ceil((burst - tokens) / rate)
+redis.call("HSET", KEYS[1], "tokens", num(tokens), "updatedAt", num(now))
+expire(reset)
+return {1, math.floor(tokens), 0, reset}
+`)
+
+// GCRA：记录理论到达时间(TAT)
+var rateLimitGCRAScript = redis.NewScript(rateLimitScriptHeader + `
+local interval = period / limit
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+local newTat = tat + n * interval
+local diff = now - (newTat - burst * interval)
+if diff < 0 then
+	local remaining = math.floor((now - (tat - burst * interval)) / interval)
+	return {0, remaining, math.ceil(-diff), math.ceil(tat - now)}
+end
+local reset = math.ceil(newTat - now)
+redis.call("SET", KEYS[1], num(newTat))
+expire(reset)
+return {1, math.floor(diff / interval), 0, reset}
+`)
+
+var rateLimitScripts = map[RateLimitAlgorithm]*redis.Script{
+	RateLimitFixedWindow:          rateLimitFixedWindowScript,
+	RateLimitSlidingWindowLog:     rateLimitSlidingWindowLogScript,
+	RateLimitSlidingWindowCounter: rateLimitSlidingWindowCounterScript,
+	RateLimitTokenBucket:          rateLimitTokenBucketScript,
+	RateLimitGCRA:                 rateLimitGCRAScript,
+}
+
+type redisRateLimiter struct {
+	cache     *RedisCache
+	algorithm RateLimitAlgorithm
+	limit     RateLimit
+}
+
+// NewRateLimiter creates a rate limiter of redis, the state of each key
+// is updated atomically by lua script with the time of redis. The key should
+// not be shared between the limiters of different algorithms.
+func (c *RedisCache) NewRateLimiter(algorithm RateLimitAlgorithm, limit RateLimit) (RateLimiter, error) {
+	err := validateRateLimit(algorithm, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &redisRateLimiter{
+		cache:     c,
+		algorithm: algorithm,
+		limit:     limit,
+	}, nil
+}
+
+// Allow is shorthand for AllowN(ctx, key, 1)
+func (r *redisRateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return r.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n requests are allowed now
+func (r *redisRateLimiter) AllowN(ctx context.Context, key string, n int) (*RateLimitResult, error) {
+	key, err := r.cache.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	burst := r.limit.capacity(r.algorithm)
+	if n <= 0 || n > burst {
+		return nil, ErrRateLimitCountInvalid
+	}
+	token := ""
+	if r.algorithm == RateLimitSlidingWindowLog {
+		token, err = newRandomID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	values, err := rateLimitScripts[r.algorithm].Run(
+		ctx,
+		r.cache.client,
+		[]string{key},
+		r.limit.Period.Microseconds(),
+		r.limit.Limit,
+		burst,
+		n,
+		token,
+	).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	return newRateLimitResult(r.limit.Limit, values), nil
+}
+
+// Reset resets the limiter of key
+func (r *redisRateLimiter) Reset(ctx context.Context, key string) error {
+	_, err := r.cache.Del(ctx, key)
+	return err
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+
+	_, err := srv.NewRateLimiter(100, RateLimit{Limit: 1, Period: time.Second})
+	assert.Equal(ErrRateLimitAlgorithmUnknown, err)
+
+	for _, algorithm := range rateLimitAlgorithms {
+		limiter, err := srv.NewRateLimiter(algorithm, RateLimit{
+			Limit:  3,
+			Period: 100 * time.Millisecond,
+		})
+		assert.Nil(err)
+		testRateLimiter(t, limiter, time.Sleep)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 读锁：清除已过期的读者，无写锁且无等待的写者时添加读者(写优先)
+var rwMutexRLockScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+if redis.call("EXISTS", KEYS[1]) == 1 or redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+redis.call("ZADD", KEYS[2], now + ttl, ARGV[1])
+redis.call("PEXPIRE", KEYS[2], ttl)
+return 1
+`)
+
+// 写锁：有读者时记录等待的写者(ARGV[3]为标记的有效期)，阻止新的读者获取读锁
+var rwMutexLockScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local waiting = redis.call("GET", KEYS[3])
+if waiting and waiting ~= ARGV[1] then
+	return 0
+end
+if redis.call("ZCARD", KEYS[2]) > 0 then
+	if tonumber(ARGV[3]) > 0 then
+		redis.call("SET", KEYS[3], ARGV[1], "PX", ARGV[3])
+	end
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+if waiting then
+	redis.call("DEL", KEYS[3])
+end
+return 1
+`)
+
+// RWMutex is the distributed read/write lock of redis, the lock can be held by
+// many readers or one writer. If a writer is waiting for the readers, new readers
+// can not obtain the lock until the writer obtains it(writer preference).
+// The keys of lock are "key:writer", "key:readers" and "key:waiting",
+// so the key should have hash tag for redis cluster.
+type RWMutex struct {
+	client redis.UniversalClient
+	key    string
+	ttl    time.Duration
+	retry  RetryStrategy
+}
+
+// NewRWMutex creates a read/write lock of key
+func (c *RedisCache) NewRWMutex(key string, ttl ...time.Duration) (*RWMutex, error) {
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &RWMutex{
+		client: c.client,
+		key:    key,
+		ttl:    c.getTTL(ttl...),
+		retry:  NewFixedRetry(defaultLockRetryDelay),
+	}, nil
+}
+
+// SetRetry sets the retry strategy of RLock and Lock, the default is fixed 50ms
+func (m *RWMutex) SetRetry(retry RetryStrategy) {
+	m.retry = retry
+}
+
+func (m *RWMutex) keys() []string {
+	return []string{
+		m.key + ":writer",
+		m.key + ":readers",
+		m.key + ":waiting",
+	}
+}
+
+// wait runs fn until the lock is obtained or the context is done,
+// the retry delay is capped by maxDelay if it is greater than 0
+func (m *RWMutex) wait(ctx context.Context, fn func(ctx context.Context) (Done, error), maxDelay time.Duration) (Done, error) {
+	for attempt := 0; ; attempt++ {
+		done, err := fn(ctx)
+		if err != ErrLockNotObtained {
+			return done, err
+		}
+		delay := m.retry(attempt)
+		if maxDelay > 0 && delay > maxDelay {
+			delay = maxDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return noop, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryRLock obtains the read lock, it returns ErrLockNotObtained if the
+// write lock is held or a writer is waiting
+func (m *RWMutex) TryRLock(ctx context.Context) (Done, error) {
+	token, err := newRandomID()
+	if err != nil {
+		return noop, err
+	}
+	keys := m.keys()
+	count, err := rwMutexRLockScript.Run(ctx, m.client, keys, token, m.ttl.Milliseconds()).Int()
+	if err != nil {
+		return noop, err
+	}
+	if count == 0 {
+		return noop, ErrLockNotObtained
+	}
+	return func() error {
+		count, err := m.client.ZRem(ctx, keys[1], token).Result()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrLockNotHeld
+		}
+		return nil
+	}, nil
+}
+
+// RLock waits until the read lock is obtained or the context is done
+func (m *RWMutex) RLock(ctx context.Context) (Done, error) {
+	return m.wait(ctx, m.TryRLock, 0)
+}
+
+// waitingTTL returns the ttl of waiting writer mark, the mark is
+// refreshed by each attempt of Lock
+func (m *RWMutex) waitingTTL() time.Duration {
+	if m.ttl < defaultLockQueueTimeout {
+		return m.ttl
+	}
+	return defaultLockQueueTimeout
+}
+
+// tryLock obtains the write lock with token, the token is marked as
+// the waiting writer for waitingTTL if the lock is held by readers
+func (m *RWMutex) tryLock(ctx context.Context, token string, waitingTTL time.Duration) (Done, error) {
+	keys := m.keys()
+	count, err := rwMutexLockScript.Run(ctx, m.client, keys, token, m.ttl.Milliseconds(), waitingTTL.Milliseconds()).Int()
+	if err != nil {
+		return noop, err
+	}
+	if count == 0 {
+		return noop, ErrLockNotObtained
+	}
+	l := &Lock{
+		client: m.client,
+		key:    keys[0],
+		token:  token,
+		ttl:    m.ttl,
+	}
+	return func() error {
+		return l.Unlock(ctx)
+	}, nil
+}
+
+// TryLock obtains the write lock, it returns ErrLockNotObtained if the lock is held by others
+func (m *RWMutex) TryLock(ctx context.Context) (Done, error) {
+	token, err := newRandomID()
+	if err != nil {
+		return noop, err
+	}
+	return m.tryLock(ctx, token, 0)
+}
+
+// Lock waits until the write lock is obtained or the context is done. If the lock
+// is held by readers, the writer is marked as waiting and new readers are blocked
+// until it obtains the lock. The mark expires if the writer stops retrying.
+func (m *RWMutex) Lock(ctx context.Context) (Done, error) {
+	token, err := newRandomID()
+	if err != nil {
+		return noop, err
+	}
+	waitingTTL := m.waitingTTL()
+	done, err := m.wait(ctx, func(ctx context.Context) (Done, error) {
+		return m.tryLock(ctx, token, waitingTTL)
+	}, waitingTTL/3)
+	if err != nil {
+		// 放弃等待，清除等待的标记
+		_ = (&Lock{
+			client: m.client,
+			key:    m.keys()[2],
+			token:  token,
+		}).Unlock(context.Background())
+	}
+	return done, err
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRWMutex(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+
+	m, err := srv.NewRWMutex(randomString(), time.Second)
+	assert.Nil(err)
+	m.SetRetry(NewFixedRetry(5 * time.Millisecond))
+
+	// 多个读者
+	rDone1, err := m.TryRLock(ctx)
+	assert.Nil(err)
+	rDone2, err := m.RLock(ctx)
+	assert.Nil(err)
+
+	// 有读者时写锁失败
+	_, err = m.TryLock(ctx)
+	assert.Equal(ErrLockNotObtained, err)
+	rDone3, err := m.TryRLock(ctx)
+	assert.Nil(err)
+	// 等待的写者阻止新的读者
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, _ = m.Lock(timeoutCtx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err = m.TryRLock(ctx)
+	assert.Equal(ErrLockNotObtained, err)
+	<-timeoutCtx.Done()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Nil(rDone1())
+	assert.Equal(ErrLockNotHeld, rDone1())
+	assert.Nil(rDone2())
+	assert.Nil(rDone3())
+
+	// 写锁独占
+	wDone, err := m.Lock(ctx)
+	assert.Nil(err)
+	_, err = m.TryRLock(ctx)
+	assert.Equal(ErrLockNotObtained, err)
+	_, err = m.TryLock(ctx)
+	assert.Equal(ErrLockNotObtained, err)
+	timeoutCtx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = m.RLock(timeoutCtx)
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Nil(wDone())
+	assert.Equal(ErrLockNotHeld, wDone())
+
+	// 写者等待读者释放
+	rDone, err := m.RLock(ctx)
+	assert.Nil(err)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = rDone()
+	}()
+	wDone, err = m.Lock(ctx)
+	assert.Nil(err)
+	assert.Nil(wDone())
+	rDone, err = m.TryRLock(ctx)
+	assert.Nil(err)
+
+	// 放弃等待后清除等待的标记
+	timeoutCtx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = m.Lock(timeoutCtx)
+	assert.Equal(context.DeadlineExceeded, err)
+	_, err = m.TryRLock(ctx)
+	assert.Nil(err)
+	assert.Nil(rDone())
+}
+
+func TestRedisRWMutexExpired(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+
+	m, err := srv.NewRWMutex(randomString(), 20*time.Millisecond)
+	assert.Nil(err)
+
+	// 已过期的读者被清除
+	_, err = m.TryRLock(ctx)
+	assert.Nil(err)
+	time.Sleep(30 * time.Millisecond)
+	wDone, err := m.TryLock(ctx)
+	assert.Nil(err)
+	assert.Nil(wDone())
+
+	_, err = srv.NewRWMutex("")
+	assert.Equal(ErrKeyIsNil, err)
+}
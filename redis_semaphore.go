@@ -0,0 +1,221 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrSemaphoreLimitInvalid = errors.New("Semaphore limit is invalid")
+var ErrSemaphorePermitsInvalid = errors.New("Semaphore permits is invalid")
+
+// 获取信号量：清除已过期的持有者，剩余数量足够时添加n个成员(token:i)
+var semaphoreAcquireScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local limit = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) + n > limit then
+	return 0
+end
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], now + ttl, ARGV[1] .. ":" .. i)
+end
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// 释放信号量：删除所有成员并返回删除的数量
+var semaphoreReleaseScript = redis.NewScript(`
+local count = 0
+for i = 1, tonumber(ARGV[2]) do
+	count = count + redis.call("ZREM", KEYS[1], ARGV[1] .. ":" .. i)
+end
+return count
+`)
+
+// 刷新信号量：仅更新未过期成员的过期时间
+var semaphoreRefreshScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local ttl = tonumber(ARGV[3])
+local count = 0
+for i = 1, tonumber(ARGV[2]) do
+	local member = ARGV[1] .. ":" .. i
+	local score = redis.call("ZSCORE", KEYS[1], member)
+	if score and tonumber(score) > now then
+		redis.call("ZADD", KEYS[1], now + ttl, member)
+		count = count + 1
+	end
+end
+if count ~= 0 and redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return count
+`)
+
+// 清除已过期的持有者并返回数量
+var semaphoreCountScript = redis.NewScript(`
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+return redis.call("ZCARD", KEYS[1])
+`)
+
+// Semaphore is the distributed counting semaphore of redis, it limits the
+// concurrency across processes. The holders are stored in a sorted set scored
+// by expiry, so the permits of crashed holders are released after ttl.
+type Semaphore struct {
+	client redis.UniversalClient
+	key    string
+	limit  int
+	ttl    time.Duration
+	retry  RetryStrategy
+}
+
+// SemaphoreLease is the permits obtained from semaphore
+type SemaphoreLease struct {
+	client  redis.UniversalClient
+	key     string
+	token   string
+	permits int
+	ttl     time.Duration
+}
+
+// NewSemaphore creates a semaphore of key with limit permits
+func (c *RedisCache) NewSemaphore(key string, limit int, ttl ...time.Duration) (*Semaphore, error) {
+	if limit <= 0 {
+		return nil, ErrSemaphoreLimitInvalid
+	}
+	key, err := c.getKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Semaphore{
+		client: c.client,
+		key:    key,
+		limit:  limit,
+		ttl:    c.getTTL(ttl...),
+		retry:  NewFixedRetry(defaultLockRetryDelay),
+	}, nil
+}
+
+// SetRetry sets the retry strategy of Acquire, the default is fixed 50ms
+func (s *Semaphore) SetRetry(retry RetryStrategy) {
+	s.retry = retry
+}
+
+// Limit returns the limit of semaphore
+func (s *Semaphore) Limit() int {
+	return s.limit
+}
+
+// Count returns the count of permits held, the expired holders are removed
+func (s *Semaphore) Count(ctx context.Context) (int, error) {
+	return semaphoreCountScript.Run(ctx, s.client, []string{s.key}).Int()
+}
+
+// TryAcquire obtains n permits, it returns ErrLockNotObtained if the
+// remaining permits are not enough
+func (s *Semaphore) TryAcquire(ctx context.Context, n int) (*SemaphoreLease, error) {
+	if n <= 0 || n > s.limit {
+		return nil, ErrSemaphorePermitsInvalid
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := semaphoreAcquireScript.Run(ctx, s.client, []string{s.key}, token, s.limit, n, s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+	if ok == 0 {
+		return nil, ErrLockNotObtained
+	}
+	return &SemaphoreLease{
+		client:  s.client,
+		key:     s.key,
+		token:   token,
+		permits: n,
+		ttl:     s.ttl,
+	}, nil
+}
+
+// Acquire waits until n permits are obtained or the context is done.
+// The waiters are not queued, so the acquirer of many permits may wait
+// longer than the acquirer of few permits.
+func (s *Semaphore) Acquire(ctx context.Context, n int) (*SemaphoreLease, error) {
+	for attempt := 0; ; attempt++ {
+		lease, err := s.TryAcquire(ctx, n)
+		if err != ErrLockNotObtained {
+			return lease, err
+		}
+		timer := time.NewTimer(s.retry(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Token returns the token of lease
+func (l *SemaphoreLease) Token() string {
+	return l.token
+}
+
+// Permits returns the count of permits held by lease
+func (l *SemaphoreLease) Permits() int {
+	return l.permits
+}
+
+// Release releases the permits, it returns ErrLockNotHeld if
+// the permits have been expired or released
+func (l *SemaphoreLease) Release(ctx context.Context) error {
+	count, err := semaphoreReleaseScript.Run(ctx, l.client, []string{l.key}, l.token, l.permits).Int()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Refresh extends the ttl of permits, it returns ErrLockNotHeld if
+// the permits have been expired or released
+func (l *SemaphoreLease) Refresh(ctx context.Context, ttl ...time.Duration) error {
+	value := l.ttl
+	if len(ttl) != 0 {
+		value = ttl[0]
+	}
+	count, err := semaphoreRefreshScript.Run(ctx, l.client, []string{l.key}, l.token, l.permits, value.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
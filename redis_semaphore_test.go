@@ -0,0 +1,140 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisSemaphore(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+
+	_, err := srv.NewSemaphore(randomString(), 0)
+	assert.Equal(ErrSemaphoreLimitInvalid, err)
+
+	s, err := srv.NewSemaphore(randomString(), 3, time.Second)
+	assert.Nil(err)
+	s.SetRetry(NewFixedRetry(5 * time.Millisecond))
+	assert.Equal(3, s.Limit())
+
+	_, err = s.TryAcquire(ctx, 0)
+	assert.Equal(ErrSemaphorePermitsInvalid, err)
+	_, err = s.TryAcquire(ctx, 4)
+	assert.Equal(ErrSemaphorePermitsInvalid, err)
+
+	l1, err := s.TryAcquire(ctx, 2)
+	assert.Nil(err)
+	assert.Equal(2, l1.Permits())
+	assert.NotEmpty(l1.Token())
+	count, err := s.Count(ctx)
+	assert.Nil(err)
+	assert.Equal(2, count)
+
+	// 剩余数量不足
+	_, err = s.TryAcquire(ctx, 2)
+	assert.Equal(ErrLockNotObtained, err)
+	l2, err := s.TryAcquire(ctx, 1)
+	assert.Nil(err)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = s.Acquire(timeoutCtx, 1)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// 释放后可获取
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = l1.Release(ctx)
+	}()
+	l3, err := s.Acquire(ctx, 2)
+	assert.Nil(err)
+	assert.Equal(ErrLockNotHeld, l1.Release(ctx))
+	assert.Nil(l2.Refresh(ctx))
+	assert.Nil(l2.Release(ctx))
+	assert.Equal(ErrLockNotHeld, l2.Refresh(ctx))
+	assert.Nil(l3.Release(ctx))
+	count, err = s.Count(ctx)
+	assert.Nil(err)
+	assert.Equal(0, count)
+}
+
+func TestRedisSemaphoreExpired(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+
+	s, err := srv.NewSemaphore(randomString(), 1, 20*time.Millisecond)
+	assert.Nil(err)
+	_, err = s.TryAcquire(ctx, 1)
+	assert.Nil(err)
+	_, err = s.TryAcquire(ctx, 1)
+	assert.Equal(ErrLockNotObtained, err)
+
+	// 持有者过期后自动清除
+	time.Sleep(30 * time.Millisecond)
+	count, err := s.Count(ctx)
+	assert.Nil(err)
+	assert.Equal(0, count)
+	l, err := s.TryAcquire(ctx, 1)
+	assert.Nil(err)
+	assert.Nil(l.Release(ctx))
+}
+
+func TestRedisSemaphoreConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient()
+	defer c.Close()
+	srv := NewRedisCache(c)
+	ctx := context.Background()
+
+	limit := 3
+	s, err := srv.NewSemaphore(randomString(), limit, time.Second)
+	assert.Nil(err)
+	s.SetRetry(NewFixedRetry(2 * time.Millisecond))
+
+	var current, maxCurrent int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := s.Acquire(ctx, 1)
+			assert.Nil(err)
+			value := atomic.AddInt32(&current, 1)
+			for {
+				prev := atomic.LoadInt32(&maxCurrent)
+				if value <= prev || atomic.CompareAndSwapInt32(&maxCurrent, prev, value) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&current, -1)
+			assert.Nil(l.Release(ctx))
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(atomic.LoadInt32(&maxCurrent), int32(limit))
+}
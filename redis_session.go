@@ -22,8 +22,10 @@ import (
 )
 
 type RedisSession struct {
-	client redis.UniversalClient
-	prefix string
+	client    redis.UniversalClient
+	prefix    string
+	encryptor *Encryptor
+	signer    *Signer
 }
 
 // NewRedisSession returns a new redis session
@@ -45,6 +47,17 @@ func (rs *RedisSession) SetPrefix(prefix string) {
 	rs.prefix = prefix
 }
 
+// SetEncryptor sets encryptor for redis session, the session data will be encrypted
+func (rs *RedisSession) SetEncryptor(encryptor *Encryptor) {
+	rs.encryptor = encryptor
+}
+
+// SetSigner sets signer for redis session, the signature of key and
+// session data will be appended, and verified on get
+func (rs *RedisSession) SetSigner(signer *Signer) {
+	rs.signer = signer
+}
+
 // Get session from redis, it will not return error if data is not exists
 func (rs *RedisSession) Get(ctx context.Context, key string) ([]byte, error) {
 	key, err := rs.getKey(key)
@@ -56,7 +69,24 @@ func (rs *RedisSession) Get(ctx context.Context, key string) ([]byte, error) {
 	if err == redis.Nil {
 		err = nil
 	}
-	return result, err
+	if err != nil || len(result) == 0 {
+		return result, err
+	}
+	if rs.signer != nil {
+		if len(result) < signatureSize {
+			return nil, ErrSignatureMismatch
+		}
+		end := len(result) - signatureSize
+		err = rs.signer.Verify(result[end:], []byte(key), result[:end])
+		if err != nil {
+			return nil, err
+		}
+		result = result[:end]
+	}
+	if rs.encryptor == nil {
+		return result, nil
+	}
+	return rs.encryptor.Decrypt(result, []byte(key))
 }
 
 // Set session to redis
@@ -65,6 +95,20 @@ func (rs *RedisSession) Set(ctx context.Context, key string, data []byte, ttl ti
 	if err != nil {
 		return err
 	}
+	if rs.encryptor != nil {
+		data, err = rs.encryptor.Encrypt(data, []byte(key))
+		if err != nil {
+			return err
+		}
+	}
+	// 加密后再签名
+	if rs.signer != nil {
+		signature := rs.signer.Sign([]byte(key), data)
+		buf := make([]byte, len(data)+len(signature))
+		copy(buf, data)
+		copy(buf[len(data):], signature)
+		data = buf
+	}
 	return rs.client.Set(ctx, key, data, ttl).Err()
 }
 
@@ -16,6 +16,7 @@ package cache
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -37,6 +38,143 @@ func (rs *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
 	return data, err
 }
 
+// 仅在key存在时更新过期时间，避免setrange创建新的key
+var touchScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("SETRANGE", KEYS[1], 0, ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+else
+	redis.call("PERSIST", KEYS[1])
+end
+return 1
+`)
+
+func (rs *redisStore) Touch(ctx context.Context, key string, expiredAt time.Time, ttl time.Duration) error {
+	header := make([]byte, timestampByteSize)
+	writeTimeToBytes(expiredAt, header)
+	count, err := touchScript.Run(ctx, rs.client, []string{
+		key,
+	}, header, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrIsNil
+	}
+	return nil
+}
+
+func (rs *redisStore) Peek(ctx context.Context, keys ...string) ([]time.Time, error) {
+	pipe := rs.client.Pipeline()
+	existsCmds := make([]*redis.IntCmd, len(keys))
+	rangeCmds := make([]*redis.StringCmd, len(keys))
+	for index, key := range keys {
+		existsCmds[index] = pipe.Exists(ctx, key)
+		rangeCmds[index] = pipe.GetRange(ctx, key, 0, timestampByteSize-1)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]time.Time, len(keys))
+	for index := range keys {
+		buf, _ := rangeCmds[index].Bytes()
+		if existsCmds[index].Val() == 0 || len(buf) < timestampByteSize {
+			continue
+		}
+		result[index] = getTimeFromBytes(buf)
+	}
+	return result, nil
+}
+
+func (rs *redisStore) PeekHeader(ctx context.Context, key string, size int) ([]byte, error) {
+	buf, err := rs.client.GetRange(ctx, key, 0, int64(size-1)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	// 不存在的key返回空字符串
+	if len(buf) == 0 {
+		return nil, ErrIsNil
+	}
+	return buf, nil
+}
+
+// 版本号为数据头中记录的8字节，无版本号的数据为versionUnknown，与getVersionFromBytes一致
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+local version = ""
+if current and #current > 8 then
+	version = "\0\0\0\0\0\0\0\1"
+	local envelope = string.byte(current, 10)
+	local flags = string.byte(current, 11)
+	if #current >= 20 and string.byte(current, 9) == 254 and
+		(envelope == 1 or envelope == 2) and math.floor(flags / 8) % 2 == 1 then
+		version = string.sub(current, 13, 20)
+	end
+end
+if version ~= ARGV[1] then
+	return 0
+end
+local ttl = tonumber(ARGV[3])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func (rs *redisStore) CompareAndSwap(ctx context.Context, key string, version uint64, value []byte, ttl time.Duration) (bool, error) {
+	count, err := compareAndSwapScript.Run(ctx, rs.client, []string{
+		key,
+	}, formatVersion(version), value, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+func (rs *redisStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return rs.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// redisGlobReplacer escapes the special characters of redis glob pattern
+var redisGlobReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"?", `\?`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// Scan scans the keys by SCAN, for the cluster client only the keys of one node are scanned
+func (rs *redisStore) Scan(ctx context.Context, prefix string, count int) ([]string, error) {
+	match := redisGlobReplacer.Replace(prefix) + "*"
+	keys := make([]string, 0, count)
+	var cursor uint64
+	for {
+		result, next, err := rs.client.Scan(ctx, cursor, match, int64(count)).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range result {
+			if len(keys) >= count {
+				return keys, nil
+			}
+			keys = append(keys, key)
+		}
+		// 已遍历所有的key
+		if next == 0 || len(keys) >= count {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
 func (rs *redisStore) Close(_ context.Context) error {
 	return rs.client.Close()
 }
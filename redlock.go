@@ -0,0 +1,251 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedlockDriftFactor = 0.01
+	// redlockClockDrift is the fixed drift of redis expiry precision
+	redlockClockDrift      = 2 * time.Millisecond
+	defaultRedlockTimeout  = 50 * time.Millisecond
+	defaultRedlockRetryMax = 3
+)
+
+var ErrRedlockClientIsNil = errors.New("Redlock client is nil")
+
+// Redlock is the distributed lock across multiple independent redis nodes,
+// the lock is obtained only if it is set on the majority of nodes within
+// the validity time.
+type Redlock struct {
+	clients     []redis.UniversalClient
+	prefix      string
+	driftFactor float64
+	timeout     time.Duration
+	retryCount  int
+	retry       RetryStrategy
+}
+
+// RedlockOption redlock option
+type RedlockOption func(r *Redlock)
+
+// RedlockPrefixOption set the prefix of lock key
+func RedlockPrefixOption(prefix string) RedlockOption {
+	return func(r *Redlock) {
+		r.prefix = prefix
+	}
+}
+
+// RedlockDriftFactorOption set the clock drift factor of ttl, default is 0.01
+func RedlockDriftFactorOption(driftFactor float64) RedlockOption {
+	return func(r *Redlock) {
+		r.driftFactor = driftFactor
+	}
+}
+
+// RedlockTimeoutOption set the timeout of each node, it should be
+// much less than the ttl of lock, default is 50ms
+func RedlockTimeoutOption(timeout time.Duration) RedlockOption {
+	return func(r *Redlock) {
+		r.timeout = timeout
+	}
+}
+
+// RedlockRetryOption set the retry count and strategy if the lock is not obtained,
+// the default is 3 times with random delay of exponential retry, the nil strategy
+// uses the fixed delay of 50ms
+func RedlockRetryOption(count int, retry RetryStrategy) RedlockOption {
+	return func(r *Redlock) {
+		r.retryCount = count
+		r.retry = retry
+	}
+}
+
+// NewRedlock creates a new redlock, the clients should connect to independent redis nodes
+func NewRedlock(clients []redis.UniversalClient, opts ...RedlockOption) (*Redlock, error) {
+	if len(clients) == 0 {
+		return nil, ErrRedlockClientIsNil
+	}
+	r := &Redlock{
+		clients:     clients,
+		driftFactor: defaultRedlockDriftFactor,
+		timeout:     defaultRedlockTimeout,
+		retryCount:  defaultRedlockRetryMax,
+		retry:       NewExponentialRetry(50*time.Millisecond, 500*time.Millisecond),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	// 未指定重试策略则使用固定间隔
+	if r.retry == nil {
+		r.retry = NewFixedRetry(defaultLockRetryDelay)
+	}
+	return r, nil
+}
+
+// quorum returns the count of majority nodes
+func (r *Redlock) quorum() int {
+	return len(r.clients)/2 + 1
+}
+
+// each runs fn for each client in parallel with timeout, and returns the count of success
+func (r *Redlock) each(ctx context.Context, fn func(ctx context.Context, client redis.UniversalClient) (bool, error)) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	for _, client := range r.clients {
+		wg.Add(1)
+		go func(client redis.UniversalClient) {
+			defer wg.Done()
+			// 避免节点异常时等待过久
+			ctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+			success, err := fn(ctx, client)
+			if err != nil || !success {
+				return
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}(client)
+	}
+	wg.Wait()
+	return count
+}
+
+// validity returns the validity time of lock, the elapsed time and clock drift are subtracted
+func (r *Redlock) validity(start time.Time, ttl time.Duration) time.Duration {
+	drift := time.Duration(float64(ttl)*r.driftFactor) + redlockClockDrift
+	return ttl - time.Since(start) - drift
+}
+
+// Lock locks the key on all nodes, it returns ErrLockNotObtained if the lock
+// is not obtained on the majority of nodes within the validity time after retries
+func (r *Redlock) Lock(ctx context.Context, key string, ttl time.Duration) (*RedlockLock, error) {
+	if key == "" {
+		return nil, ErrKeyIsNil
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	l := &RedlockLock{
+		redlock: r,
+		key:     r.prefix + key,
+		token:   token,
+		ttl:     ttl,
+	}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		count := r.each(ctx, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+			return client.SetNX(ctx, l.key, l.token, ttl).Result()
+		})
+		validity := r.validity(start, ttl)
+		if count >= r.quorum() && validity > 0 {
+			l.until = start.Add(validity)
+			return l, nil
+		}
+		// 获取失败，删除已设置的节点
+		r.unlock(ctx, l)
+		if attempt >= r.retryCount {
+			return nil, ErrLockNotObtained
+		}
+		timer := time.NewTimer(r.retry(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *Redlock) unlock(ctx context.Context, l *RedlockLock) int {
+	return r.each(ctx, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		count, err := unlockScript.Run(ctx, client, []string{
+			l.key,
+		}, l.token, lockReleasedChannel(l.key)).Int()
+		return count == 1, err
+	})
+}
+
+// RedlockLock is the lock obtained by Redlock
+type RedlockLock struct {
+	redlock *Redlock
+	key     string
+	token   string
+	ttl     time.Duration
+	until   time.Time
+}
+
+// Key returns the key of lock(with prefix)
+func (l *RedlockLock) Key() string {
+	return l.key
+}
+
+// Token returns the owner token of lock
+func (l *RedlockLock) Token() string {
+	return l.token
+}
+
+// Until returns the time until which the lock is valid
+func (l *RedlockLock) Until() time.Time {
+	return l.until
+}
+
+// Validity returns the remaining validity time of lock
+func (l *RedlockLock) Validity() time.Duration {
+	return time.Until(l.until)
+}
+
+// Unlock deletes the lock on all nodes, it returns ErrLockNotHeld
+// if the lock is not held by any node
+func (l *RedlockLock) Unlock(ctx context.Context) error {
+	if l.redlock.unlock(ctx, l) == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Refresh resets the ttl of lock on all nodes, the ttl of lock creation will be used
+// if ttl is nil. It returns ErrLockNotHeld if the lock is not refreshed on
+// the majority of nodes within the validity time.
+func (l *RedlockLock) Refresh(ctx context.Context, ttl ...time.Duration) error {
+	d := l.ttl
+	if len(ttl) != 0 {
+		d = ttl[0]
+	}
+	start := time.Now()
+	count := l.redlock.each(ctx, func(ctx context.Context, client redis.UniversalClient) (bool, error) {
+		count, err := refreshScript.Run(ctx, client, []string{
+			l.key,
+		}, l.token, d.Milliseconds()).Int()
+		return count == 1, err
+	})
+	validity := l.redlock.validity(start, d)
+	if count < l.redlock.quorum() || validity <= 0 {
+		return ErrLockNotHeld
+	}
+	l.ttl = d
+	l.until = start.Add(validity)
+	return nil
+}
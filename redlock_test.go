@@ -0,0 +1,152 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRedlockClients creates the clients of different db as independent nodes,
+// and the clients of unreachable address as failed nodes
+func newRedlockClients(count, failed int) []redis.UniversalClient {
+	clients := make([]redis.UniversalClient, 0, count+failed)
+	for i := 0; i < count; i++ {
+		clients = append(clients, redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+			DB:   i + 1,
+		}))
+	}
+	for i := 0; i < failed; i++ {
+		clients = append(clients, redis.NewClient(&redis.Options{
+			Addr:       "localhost:1",
+			MaxRetries: -1,
+		}))
+	}
+	return clients
+}
+
+func closeRedlockClients(clients []redis.UniversalClient) {
+	for _, c := range clients {
+		_ = c.Close()
+	}
+}
+
+func TestRedlock(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := NewRedlock(nil)
+	assert.Equal(ErrRedlockClientIsNil, err)
+
+	clients := newRedlockClients(3, 2)
+	defer closeRedlockClients(clients)
+	r, err := NewRedlock(clients, RedlockPrefixOption("redlock:"), RedlockRetryOption(0, nil))
+	assert.Nil(err)
+	key := randomString()
+
+	// 多数节点成功
+	l, err := r.Lock(ctx, key, time.Second)
+	assert.Nil(err)
+	assert.Equal("redlock:"+key, l.Key())
+	assert.True(l.Validity() > 0 && l.Validity() < time.Second)
+	for _, c := range clients[:3] {
+		token, err := c.Get(ctx, l.Key()).Result()
+		assert.Nil(err)
+		assert.Equal(l.Token(), token)
+	}
+
+	_, err = r.Lock(ctx, key, time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+
+	err = l.Refresh(ctx, time.Minute)
+	assert.Nil(err)
+	assert.True(l.Validity() > time.Second)
+
+	// 所有节点均释放
+	err = l.Unlock(ctx)
+	assert.Nil(err)
+	for _, c := range clients[:3] {
+		_, err := c.Get(ctx, l.Key()).Result()
+		assert.Equal(redis.Nil, err)
+	}
+	err = l.Unlock(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+	err = l.Refresh(ctx)
+	assert.Equal(ErrLockNotHeld, err)
+
+	_, err = r.Lock(ctx, "", time.Second)
+	assert.Equal(ErrKeyIsNil, err)
+}
+
+func TestRedlockMinority(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// 仅少数节点可用
+	clients := newRedlockClients(2, 3)
+	defer closeRedlockClients(clients)
+	r, err := NewRedlock(clients, RedlockRetryOption(1, NewFixedRetry(time.Millisecond)))
+	assert.Nil(err)
+	key := randomString()
+	_, err = r.Lock(ctx, key, time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+	// 获取失败后删除已设置的节点
+	for _, c := range clients[:2] {
+		_, err := c.Get(ctx, key).Result()
+		assert.Equal(redis.Nil, err)
+	}
+	// 未指定重试策略则使用固定间隔
+	r, err = NewRedlock(clients, RedlockRetryOption(2, nil))
+	assert.Nil(err)
+	_, err = r.Lock(ctx, key, time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+
+	// 部分节点已被其它实例获取
+	clients = newRedlockClients(3, 0)
+	defer closeRedlockClients(clients)
+	r, err = NewRedlock(clients, RedlockRetryOption(0, nil))
+	assert.Nil(err)
+	key = randomString()
+	for _, c := range clients[:2] {
+		err = c.Set(ctx, key, "other", time.Minute).Err()
+		assert.Nil(err)
+	}
+	_, err = r.Lock(ctx, key, time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+	token, err := clients[0].Get(ctx, key).Result()
+	assert.Nil(err)
+	assert.Equal("other", token)
+	_, err = clients[2].Get(ctx, key).Result()
+	assert.Equal(redis.Nil, err)
+
+	// 有效时间不足
+	r, err = NewRedlock(clients, RedlockRetryOption(0, nil), RedlockDriftFactorOption(1))
+	assert.Nil(err)
+	_, err = r.Lock(ctx, randomString(), time.Second)
+	assert.Equal(ErrLockNotObtained, err)
+
+	// context取消
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	r, err = NewRedlock(clients, RedlockRetryOption(3, NewFixedRetry(time.Second)))
+	assert.Nil(err)
+	_, err = r.Lock(cancelCtx, key, time.Second)
+	assert.Equal(context.Canceled, err)
+}
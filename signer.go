@@ -0,0 +1,97 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// signatureSize is the size of signature: key id(1) | hmac-sha256(32)
+const signatureSize = 1 + sha256.Size
+
+var ErrSignKeyIsNil = errors.New("Sign key is nil")
+var ErrSignatureMismatch = errors.New("Signature mismatch")
+
+// SignerKey is the key of signer
+type SignerKey struct {
+	// ID is recorded with the signature, it is used to find the key for verification
+	ID byte
+	// Key is the secret of hmac
+	Key []byte
+}
+
+// Signer signs and verifies data with HMAC-SHA256,
+// it supports multiple keys for key rotation.
+type Signer struct {
+	currentID byte
+	keys      map[byte][]byte
+}
+
+// NewSigner creates a new signer, the first key is used for signing,
+// and all keys are used for verification by the key id of signature
+func NewSigner(keys ...SignerKey) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, ErrSignKeyIsNil
+	}
+	m := make(map[byte][]byte, len(keys))
+	for _, key := range keys {
+		if len(key.Key) == 0 {
+			return nil, ErrSignKeyIsNil
+		}
+		m[key.ID] = key.Key
+	}
+	return &Signer{
+		currentID: keys[0].ID,
+		keys:      m,
+	}, nil
+}
+
+func (s *Signer) sum(secret []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	size := make([]byte, 4)
+	for _, item := range data {
+		// 写入长度，避免不同的分段拼接后相同
+		binary.BigEndian.PutUint32(size, uint32(len(item)))
+		_, _ = mac.Write(size)
+		_, _ = mac.Write(item)
+	}
+	return mac.Sum(nil)
+}
+
+// Sign returns the signature of data with current key
+func (s *Signer) Sign(data ...[]byte) []byte {
+	signature := make([]byte, 1, signatureSize)
+	signature[0] = s.currentID
+	return append(signature, s.sum(s.keys[s.currentID], data...)...)
+}
+
+// Verify verifies the signature of data, it returns
+// ErrSignatureMismatch if the signature is invalid
+func (s *Signer) Verify(signature []byte, data ...[]byte) error {
+	if len(signature) != signatureSize {
+		return ErrSignatureMismatch
+	}
+	secret, ok := s.keys[signature[0]]
+	if !ok {
+		return ErrSignatureMismatch
+	}
+	if !hmac.Equal(signature[1:], s.sum(secret, data...)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSignerKey1 = SignerKey{
+	ID:  1,
+	Key: []byte("secret1"),
+}
+
+var testSignerKey2 = SignerKey{
+	ID:  2,
+	Key: []byte("secret2"),
+}
+
+func TestSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewSigner()
+	assert.Equal(ErrSignKeyIsNil, err)
+
+	s1, err := NewSigner(testSignerKey1)
+	assert.Nil(err)
+	signature := s1.Sign([]byte("key"), []byte("value"))
+	assert.Equal(signatureSize, len(signature))
+	assert.Equal(testSignerKey1.ID, signature[0])
+	assert.Nil(s1.Verify(signature, []byte("key"), []byte("value")))
+
+	// 分段不同时签名不同
+	assert.Equal(ErrSignatureMismatch, s1.Verify(signature, []byte("keyv"), []byte("alue")))
+	assert.Equal(ErrSignatureMismatch, s1.Verify(signature, []byte("key"), []byte("value1")))
+	assert.Equal(ErrSignatureMismatch, s1.Verify(signature[:10], []byte("key"), []byte("value")))
+
+	// 轮换key
+	s2, err := NewSigner(testSignerKey2, testSignerKey1)
+	assert.Nil(err)
+	assert.Nil(s2.Verify(signature, []byte("key"), []byte("value")))
+	signature = s2.Sign([]byte("key"), []byte("value"))
+	assert.Equal(testSignerKey2.ID, signature[0])
+	assert.Equal(ErrSignatureMismatch, s1.Verify(signature, []byte("key"), []byte("value")))
+}
+
+func TestCacheSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	signer, err := NewSigner(testSignerKey1)
+	assert.Nil(err)
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	errs := make([]error, 0)
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheSignerOption(signer),
+		CacheChecksumOption(),
+		CacheOnErrorOption(func(key string, err error) {
+			errs = append(errs, err)
+		}),
+	)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	key := randomString()
+	err = c.Set(context.Background(), key, &testData{Name: "abc"})
+	assert.Nil(err)
+	data := testData{}
+	err = c.Get(context.Background(), key, &data)
+	assert.Nil(err)
+	assert.Equal("abc", data.Name)
+
+	// touch不影响签名
+	err = c.Touch(context.Background(), key)
+	assert.Nil(err)
+	err = c.Get(context.Background(), key, &data)
+	assert.Nil(err)
+
+	// 由其它服务写入的未签名数据
+	plainCache, err := New(time.Minute, CacheStoreOption(store))
+	assert.Nil(err)
+	err = plainCache.Set(context.Background(), key, &testData{Name: "def"})
+	assert.Nil(err)
+	err = c.Get(context.Background(), key, &data)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal([]error{ErrSignatureMismatch}, errs)
+
+	// 篡改数据(同时更新校验和)
+	err = c.Set(context.Background(), key, &testData{Name: "abc"})
+	assert.Nil(err)
+	buf, err := store.Get(context.Background(), key)
+	assert.Nil(err)
+	headerEnd := envelopeHeaderEnd(buf)
+	offset := envelopeDataOffset(headerEnd, buf[timestampByteSize+2])
+	buf[offset+1] = '['
+	binary.BigEndian.PutUint32(buf[headerEnd:], envelopeChecksum(buf, headerEnd, offset))
+	err = store.Set(context.Background(), key, buf, time.Minute)
+	assert.Nil(err)
+	err = c.Get(context.Background(), key, &data)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal([]error{ErrSignatureMismatch, ErrSignatureMismatch}, errs)
+}
+
+func TestRedisSessionSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	signer, err := NewSigner(testSignerKey1)
+	assert.Nil(err)
+	e, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	c := newClient()
+	defer c.Close()
+	rs := NewRedisSession(c)
+	rs.SetSigner(signer)
+	rs.SetEncryptor(e)
+	key := randomString()
+	ctx := context.Background()
+
+	data := []byte(`{"account":"tree"}`)
+	err = rs.Set(ctx, key, data, time.Minute)
+	assert.Nil(err)
+	result, err := rs.Get(ctx, key)
+	assert.Nil(err)
+	assert.Equal(data, result)
+
+	// 篡改数据
+	buf, err := c.Get(ctx, key).Bytes()
+	assert.Nil(err)
+	buf[len(buf)-1]++
+	err = c.Set(ctx, key, buf, time.Minute).Err()
+	assert.Nil(err)
+	_, err = rs.Get(ctx, key)
+	assert.Equal(ErrSignatureMismatch, err)
+
+	err = rs.Destroy(ctx, key)
+	assert.Nil(err)
+}
@@ -29,3 +29,49 @@ type Store interface {
 	// Close closes the store
 	Close(ctx context.Context) error
 }
+
+// Toucher is the optional interface of store, it updates the
+// expired time of data without rewriting the value
+type Toucher interface {
+	// Touch writes the expired time to the header of data and resets the ttl,
+	// it returns ErrIsNil if the key is not exists
+	Touch(ctx context.Context, key string, expiredAt time.Time, ttl time.Duration) error
+}
+
+// Peeker is the optional interface of store, it gets the
+// expired time of data without reading the whole value
+type Peeker interface {
+	// Peek gets the expired time from the header of data,
+	// the zero time will be returned if the key is not exists
+	Peek(ctx context.Context, keys ...string) ([]time.Time, error)
+}
+
+// HeaderPeeker is the optional interface of store, it gets the
+// header of data without reading the whole value
+type HeaderPeeker interface {
+	// PeekHeader gets at most size bytes from the beginning of data,
+	// it returns ErrIsNil if the key is not exists
+	PeekHeader(ctx context.Context, key string, size int) ([]byte, error)
+}
+
+// CompareAndSwapper is the optional interface of store, it sets
+// data only if the version of current data is matched
+type CompareAndSwapper interface {
+	// CompareAndSwap sets the value if the version of current data equals to version,
+	// the version 0 means the data should not exist.
+	// It returns false if the version is mismatched
+	CompareAndSwap(ctx context.Context, key string, version uint64, value []byte, ttl time.Duration) (bool, error)
+}
+
+// Adder is the optional interface of store, it sets data only if the key is not exists
+type Adder interface {
+	// Add sets the value only if the key is not exists, it returns false if the key is exists
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// Scanner is the optional interface of store, it is used to sample the keys of store
+type Scanner interface {
+	// Scan returns at most count keys which have the prefix,
+	// the order of keys is not guaranteed
+	Scan(ctx context.Context, prefix string, count int) ([]string, error)
+}
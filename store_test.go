@@ -16,6 +16,8 @@ package cache
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"testing"
 	"time"
 
@@ -64,6 +66,95 @@ func TestStore(t *testing.T) {
 		assert.Nil(err)
 		assert.Equal(value, v)
 
+		if toucher, ok := store.(Toucher); ok {
+			expiredAt := time.Now().Add(time.Minute)
+			err = toucher.Touch(context.Background(), key, expiredAt, time.Minute)
+			assert.Nil(err)
+			v, err = store.Get(context.Background(), key)
+			assert.Nil(err)
+			assert.Equal(expiredAt.UnixNano(), getTimeFromBytes(v).UnixNano())
+
+			err = toucher.Touch(context.Background(), randomString(), expiredAt, time.Minute)
+			assert.Equal(ErrIsNil, err)
+		}
+
+		if cas, ok := store.(CompareAndSwapper); ok {
+			casKey := randomString()
+			data := []byte("01234567value")
+			success, err := cas.CompareAndSwap(context.Background(), casKey, 1, data, time.Minute)
+			assert.Nil(err)
+			assert.False(success)
+			success, err = cas.CompareAndSwap(context.Background(), casKey, 0, data, time.Minute)
+			assert.Nil(err)
+			assert.True(success)
+			success, err = cas.CompareAndSwap(context.Background(), casKey, 0, data, time.Minute)
+			assert.Nil(err)
+			assert.False(success)
+			// 无版本号的数据
+			assert.Equal(versionUnknown, getVersionFromBytes(data))
+			success, err = cas.CompareAndSwap(context.Background(), casKey, versionUnknown, data, time.Minute)
+			assert.Nil(err)
+			assert.True(success)
+			// 数据头中记录的版本号
+			versioned, offset := newEnvelope(envelopeFlagVersioned, CodecRaw, nil, 5)
+			copy(versioned[offset:], "value")
+			writeEnvelopeVersion(versioned, 100)
+			writeTimeToBytes(time.Now().Add(time.Minute), versioned)
+			assert.Equal(uint64(100), getVersionFromBytes(versioned))
+			success, err = cas.CompareAndSwap(context.Background(), casKey, versionUnknown, versioned, time.Minute)
+			assert.Nil(err)
+			assert.True(success)
+			success, err = cas.CompareAndSwap(context.Background(), casKey, versionUnknown, data, time.Minute)
+			assert.Nil(err)
+			assert.False(success)
+			success, err = cas.CompareAndSwap(context.Background(), casKey, 100, data, time.Minute)
+			assert.Nil(err)
+			assert.True(success)
+			err = store.Delete(context.Background(), casKey)
+			assert.Nil(err)
+		}
+
+		if adder, ok := store.(Adder); ok {
+			addKey := randomString()
+			data := []byte("01234567value")
+			success, err := adder.Add(context.Background(), addKey, data, time.Minute)
+			assert.Nil(err)
+			assert.True(success)
+			success, err = adder.Add(context.Background(), addKey, data, time.Minute)
+			assert.Nil(err)
+			assert.False(success)
+			err = store.Delete(context.Background(), addKey)
+			assert.Nil(err)
+		}
+
+		if scanner, ok := store.(Scanner); ok {
+			prefix := "scan:" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+			for i := 0; i < 3; i++ {
+				err = store.Set(context.Background(), prefix+strconv.Itoa(i), value, time.Minute)
+				assert.Nil(err)
+			}
+			keys, err := scanner.Scan(context.Background(), prefix, 10)
+			assert.Nil(err)
+			sort.Strings(keys)
+			assert.Equal([]string{
+				prefix + "0",
+				prefix + "1",
+				prefix + "2",
+			}, keys)
+			keys, err = scanner.Scan(context.Background(), prefix, 2)
+			assert.Nil(err)
+			assert.Equal(2, len(keys))
+		}
+
+		// touch后数据头为过期时间
+		if peeker, ok := store.(Peeker); ok {
+			result, err := peeker.Peek(context.Background(), key, randomString())
+			assert.Nil(err)
+			assert.Equal(2, len(result))
+			assert.False(result[0].IsZero())
+			assert.True(result[1].IsZero())
+		}
+
 		err = store.Delete(context.Background(), key)
 		assert.Nil(err)
 
@@ -0,0 +1,126 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	// TransformerCompress the id of compress transformer
+	TransformerCompress byte = iota + 1
+	// TransformerEncrypt the id of encrypt transformer
+	TransformerEncrypt
+	// TransformerChecksum the id of checksum transformer
+	TransformerChecksum
+)
+
+var ErrTransformerDuplicated = errors.New("Transformer is duplicated")
+var ErrTransformerConflict = errors.New("Transformer conflicts with compressor or encryptor")
+
+// Transformer is one stage of the transformer chain of cache, the stages
+// run in order on write and in reverse order on read. The id of each stage
+// is recorded with the data, so the data can be read if the chain is changed.
+type Transformer interface {
+	// ID returns the identifier of transformer, it should be unique in the chain,
+	// the id less than 128 is reserved for built-in transformers
+	ID() byte
+	// Encode transforms the data on write
+	Encode(key string, data []byte) ([]byte, error)
+	// Decode restores the data on read
+	Decode(key string, data []byte) ([]byte, error)
+}
+
+type compressTransformer struct {
+	compressor Compressor
+}
+
+func (ct *compressTransformer) ID() byte {
+	return TransformerCompress
+}
+
+func (ct *compressTransformer) Encode(_ string, data []byte) ([]byte, error) {
+	return ct.compressor.Encode(data)
+}
+
+func (ct *compressTransformer) Decode(_ string, data []byte) ([]byte, error) {
+	// 未指定压缩，则使用内置的解压方式
+	if ct.compressor == nil {
+		return decompress(data)
+	}
+	return ct.compressor.Decode(data)
+}
+
+// NewCompressTransformer creates a transformer which compresses the data by compressor
+func NewCompressTransformer(compressor Compressor) Transformer {
+	return &compressTransformer{
+		compressor: compressor,
+	}
+}
+
+type encryptTransformer struct {
+	encryptor *Encryptor
+}
+
+func (et *encryptTransformer) ID() byte {
+	return TransformerEncrypt
+}
+
+func (et *encryptTransformer) Encode(key string, data []byte) ([]byte, error) {
+	// 使用key作为附加数据，避免数据被复制至其它key
+	return et.encryptor.Encrypt(data, []byte(key))
+}
+
+func (et *encryptTransformer) Decode(key string, data []byte) ([]byte, error) {
+	return et.encryptor.Decrypt(data, []byte(key))
+}
+
+// NewEncryptTransformer creates a transformer which encrypts the data by encryptor
+func NewEncryptTransformer(encryptor *Encryptor) Transformer {
+	return &encryptTransformer{
+		encryptor: encryptor,
+	}
+}
+
+type checksumTransformer struct{}
+
+func (ct *checksumTransformer) ID() byte {
+	return TransformerChecksum
+}
+
+func (ct *checksumTransformer) Encode(_ string, data []byte) ([]byte, error) {
+	buf := make([]byte, len(data)+checksumSize)
+	copy(buf, data)
+	binary.BigEndian.PutUint32(buf[len(data):], crc32.Checksum(data, crc32cTable))
+	return buf, nil
+}
+
+func (ct *checksumTransformer) Decode(_ string, data []byte) ([]byte, error) {
+	if len(data) < checksumSize {
+		return nil, ErrChecksumMismatch
+	}
+	end := len(data) - checksumSize
+	if crc32.Checksum(data[:end], crc32cTable) != binary.BigEndian.Uint32(data[end:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return data[:end], nil
+}
+
+// NewChecksumTransformer creates a transformer which appends the crc32c of data
+func NewChecksumTransformer() Transformer {
+	return &checksumTransformer{}
+}
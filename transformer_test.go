@@ -0,0 +1,257 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testReverseTransformer struct{}
+
+func (rt *testReverseTransformer) ID() byte {
+	return 200
+}
+
+func (rt *testReverseTransformer) reverse(data []byte) []byte {
+	buf := make([]byte, len(data))
+	for index, b := range data {
+		buf[len(data)-1-index] = b
+	}
+	return buf
+}
+
+func (rt *testReverseTransformer) Encode(_ string, data []byte) ([]byte, error) {
+	return rt.reverse(data), nil
+}
+
+func (rt *testReverseTransformer) Decode(_ string, data []byte) ([]byte, error) {
+	return rt.reverse(data), nil
+}
+
+func TestTransformer(t *testing.T) {
+	assert := assert.New(t)
+
+	encryptor, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+	data := []byte(strings.Repeat("Hello World!", 10))
+	tests := []struct {
+		transformer Transformer
+		id          byte
+	}{
+		{
+			transformer: NewCompressTransformer(NewS2Compressor(10)),
+			id:          TransformerCompress,
+		},
+		{
+			transformer: NewEncryptTransformer(encryptor),
+			id:          TransformerEncrypt,
+		},
+		{
+			transformer: NewChecksumTransformer(),
+			id:          TransformerChecksum,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.id, tt.transformer.ID())
+		buf, err := tt.transformer.Encode("key", data)
+		assert.Nil(err)
+		assert.NotEqual(data, buf)
+		result, err := tt.transformer.Decode("key", buf)
+		assert.Nil(err)
+		assert.Equal(data, result)
+	}
+
+	checksum := NewChecksumTransformer()
+	buf, err := checksum.Encode("", data)
+	assert.Nil(err)
+	buf[0] ^= 0xff
+	_, err = checksum.Decode("", buf)
+	assert.Equal(ErrChecksumMismatch, err)
+	_, err = checksum.Decode("", []byte("abc"))
+	assert.Equal(ErrChecksumMismatch, err)
+
+	// 加密使用key作为附加数据
+	buf, err = NewEncryptTransformer(encryptor).Encode("key", data)
+	assert.Nil(err)
+	_, err = NewEncryptTransformer(encryptor).Decode("other", buf)
+	assert.Equal(ErrDecryptFail, err)
+}
+
+func TestCacheTransformer(t *testing.T) {
+	assert := assert.New(t)
+
+	encryptor, err := NewEncryptor(testEncryptorKey1)
+	assert.Nil(err)
+
+	_, err = New(
+		time.Minute,
+		CacheS2Option(10),
+		CacheTransformerOption(NewChecksumTransformer()),
+	)
+	assert.Equal(ErrTransformerConflict, err)
+	_, err = New(
+		time.Minute,
+		CacheTransformerOption(NewChecksumTransformer(), NewChecksumTransformer()),
+	)
+	assert.Equal(ErrTransformerDuplicated, err)
+
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	var errs []error
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheTransformerOption(
+			NewCompressTransformer(NewS2Compressor(10)),
+			NewEncryptTransformer(encryptor),
+			NewChecksumTransformer(),
+		),
+		CacheOnErrorOption(func(key string, err error) {
+			errs = append(errs, err)
+		}),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	key := randomString()
+	value := []byte(strings.Repeat("Hello World!", 10))
+	err = c.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	buf, err := c.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 记录各transformer的id
+	raw, err := store.Get(ctx, key)
+	assert.Nil(err)
+	env, err := parseEnvelope(raw)
+	assert.Nil(err)
+	assert.Equal(envelopeVersion2, env.version)
+	assert.Equal([]byte{
+		TransformerCompress,
+		TransformerEncrypt,
+		TransformerChecksum,
+	}, env.stages)
+	err = c.Touch(ctx, key, time.Hour)
+	assert.Nil(err)
+
+	// 配置压缩与加密的缓存可读取
+	optionCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheS2Option(10),
+		CacheEncryptorOption(encryptor),
+	)
+	assert.Nil(err)
+	buf, err = optionCache.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+	// 未配置加密的缓存当作不存在
+	plainCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+	)
+	assert.Nil(err)
+	_, err = plainCache.GetBytes(ctx, key)
+	assert.Equal(ErrIsNil, err)
+
+	// 配置压缩与加密写入的数据也可读取
+	key = randomString()
+	err = optionCache.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	buf, err = c.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 数据损坏
+	key = randomString()
+	err = c.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	raw, err = store.Get(ctx, key)
+	assert.Nil(err)
+	raw = append([]byte{}, raw...)
+	raw[len(raw)-2] = 'A'
+	raw[len(raw)-3] = 'A'
+	err = store.Set(ctx, key, raw, time.Minute)
+	assert.Nil(err)
+	_, err = c.GetBytes(ctx, key)
+	assert.Equal(ErrIsNil, err)
+	assert.Equal([]error{ErrChecksumMismatch}, errs)
+
+	// 自定义的transformer
+	customCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheTransformerOption(&testReverseTransformer{}, NewChecksumTransformer()),
+	)
+	assert.Nil(err)
+	key = randomString()
+	err = customCache.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	buf, err = customCache.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+	_, err = c.GetBytes(ctx, key)
+	assert.Equal(ErrIsNil, err)
+}
+
+func TestCacheTransformerSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	signer, err := NewSigner(testSignerKey1)
+	assert.Nil(err)
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheSignerOption(signer),
+		CacheChecksumOption(),
+		CacheTransformerOption(
+			NewChecksumTransformer(),
+			&testReverseTransformer{},
+		),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	key := randomString()
+	value := []byte("Hello World!")
+	err = c.SetBytes(ctx, key, value)
+	assert.Nil(err)
+	buf, err := c.GetBytes(ctx, key)
+	assert.Nil(err)
+	assert.Equal(value, buf)
+
+	// 修改transformer的记录，签名校验失败
+	raw, err := store.Get(ctx, key)
+	assert.Nil(err)
+	raw = append([]byte{}, raw...)
+	raw[envelopeHeaderSize+1] = (&testReverseTransformer{}).ID()
+	raw[envelopeHeaderSize+2] = TransformerChecksum
+	headerEnd := envelopeHeaderEnd(raw)
+	offset := envelopeDataOffset(headerEnd, raw[timestampByteSize+2])
+	binary.BigEndian.PutUint32(raw[headerEnd:], envelopeChecksum(raw, headerEnd, offset))
+	err = store.Set(ctx, key, raw, time.Minute)
+	assert.Nil(err)
+	_, err = c.GetBytes(ctx, key)
+	assert.Equal(ErrIsNil, err)
+}
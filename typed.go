@@ -0,0 +1,175 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TypedOption typed cache option
+type TypedOption[K comparable] struct {
+	// EncodeKey encodes the key to string, fmt.Sprint will be used if it is nil
+	EncodeKey func(key K) string
+	// Codec marshals and unmarshals the value, the codec of cache will be used if it is nil
+	Codec Codec
+}
+
+// Typed is the typed cache of key and value, it is based on Cache
+type Typed[K comparable, V any] struct {
+	cache     *Cache
+	encodeKey func(key K) string
+	codec     Codec
+	mu        sync.Mutex
+	// calls is the loading calls by key
+	calls map[string]*loadCall[V]
+}
+
+// loadCall is the loading call of key, the result is
+// shared with the callers waiting for it
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// LoadFunc loads the value of key when it is not exists in cache
+type LoadFunc[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// NewTyped creates a new typed cache
+func NewTyped[K comparable, V any](c *Cache, opt TypedOption[K]) *Typed[K, V] {
+	encodeKey := opt.EncodeKey
+	if encodeKey == nil {
+		encodeKey = func(key K) string {
+			// 字符串则无需转换
+			if s, ok := any(key).(string); ok {
+				return s
+			}
+			return fmt.Sprint(key)
+		}
+	}
+	codec := opt.Codec
+	if codec == nil {
+		codec = c.codec
+	}
+	return &Typed[K, V]{
+		cache:     c,
+		encodeKey: encodeKey,
+		codec:     codec,
+		calls:     make(map[string]*loadCall[V]),
+	}
+}
+
+// Get gets the value of key from cache
+func (t *Typed[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var value V
+	e, _, err := t.cache.get(ctx, t.encodeKey(key))
+	if err != nil {
+		return value, err
+	}
+	err = t.cache.unmarshalEntry(e, t.codec, &value)
+	if err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Set sets the value of key to cache
+func (t *Typed[K, V]) Set(ctx context.Context, key K, value V, ttl ...time.Duration) error {
+	buf, err := marshalValue(t.codec, &value)
+	if err != nil {
+		return err
+	}
+	return t.cache.set(ctx, t.encodeKey(key), codecID(t.codec), buf, ttl...)
+}
+
+// Delete deletes the value of key from cache
+func (t *Typed[K, V]) Delete(ctx context.Context, key K) error {
+	return t.cache.Delete(ctx, t.encodeKey(key))
+}
+
+// GetOrLoad gets the value of key from cache, if it is not exists,
+// the load function will be called and the value will be set to cache.
+// The load function is called once at the same time for the same key in this process,
+// the other callers of the key wait for its result until their context is done.
+func (t *Typed[K, V]) GetOrLoad(ctx context.Context, key K, load LoadFunc[K, V], ttl ...time.Duration) (V, error) {
+	value, err := t.Get(ctx, key)
+	if err != ErrIsNil {
+		return value, err
+	}
+	k := t.encodeKey(key)
+	t.mu.Lock()
+	// 已有加载中的请求，等待其结果
+	if call, ok := t.calls[k]; ok {
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return value, ctx.Err()
+		case <-call.done:
+			return call.value, call.err
+		}
+	}
+	call := &loadCall[V]{
+		done: make(chan struct{}),
+		// 加载未正常完成(如panic)时，等待的请求当作不存在
+		err: ErrIsNil,
+	}
+	t.calls[k] = call
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.calls, k)
+		t.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = t.load(ctx, key, load, ttl...)
+	return call.value, call.err
+}
+
+// load gets the value of key again and loads it if it is not exists
+func (t *Typed[K, V]) load(ctx context.Context, key K, load LoadFunc[K, V], ttl ...time.Duration) (V, error) {
+	// 再次获取，有可能已被其它加载
+	value, err := t.Get(ctx, key)
+	if err != ErrIsNil {
+		return value, err
+	}
+	value, err = load(ctx, key)
+	if err != nil {
+		return value, err
+	}
+	err = t.Set(ctx, key, value, ttl...)
+	if err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// MGet gets the values of keys from cache, the key which is not exists will be ignored
+func (t *Typed[K, V]) MGet(ctx context.Context, keys ...K) (map[K]V, error) {
+	result := make(map[K]V, len(keys))
+	for _, key := range keys {
+		value, err := t.Get(ctx, key)
+		if err == ErrIsNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
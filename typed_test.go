@@ -0,0 +1,136 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTyped(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(time.Minute)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	tc := NewTyped[int, testData](c, TypedOption[int]{
+		EncodeKey: func(key int) string {
+			return "user:" + strconv.Itoa(key)
+		},
+	})
+
+	_, err = tc.Get(context.Background(), 1)
+	assert.Equal(ErrIsNil, err)
+
+	err = tc.Set(context.Background(), 1, testData{Name: "a"})
+	assert.Nil(err)
+	data, err := tc.Get(context.Background(), 1)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	// 通过编码后的key获取
+	data = testData{}
+	err = c.Get(context.Background(), "user:1", &data)
+	assert.Nil(err)
+	assert.Equal("a", data.Name)
+
+	result, err := tc.MGet(context.Background(), 1, 2)
+	assert.Nil(err)
+	assert.Equal(map[int]testData{
+		1: {Name: "a"},
+	}, result)
+
+	err = tc.Delete(context.Background(), 1)
+	assert.Nil(err)
+	_, err = tc.Get(context.Background(), 1)
+	assert.Equal(ErrIsNil, err)
+
+	// 自定义marshal/unmarshal
+	customTC := NewTyped[string, testDataCustom](c, TypedOption[string]{})
+	err = customTC.Set(context.Background(), "custom", testDataCustom{Name: "custom"})
+	assert.Nil(err)
+	buf, err := c.GetBytes(context.Background(), "custom")
+	assert.Nil(err)
+	assert.Equal("custom", string(buf))
+	dataCustom, err := customTC.Get(context.Background(), "custom")
+	assert.Nil(err)
+	assert.Equal("custom", dataCustom.Name)
+}
+
+func TestTypedGetOrLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(time.Minute)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+
+	tc := NewTyped[string, *testData](c, TypedOption[string]{})
+	var count int32
+	load := func(ctx context.Context, key string) (*testData, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &testData{
+			Name: key,
+		}, nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := tc.GetOrLoad(context.Background(), "a", load)
+			assert.Nil(err)
+			assert.Equal("a", data.Name)
+		}()
+	}
+	wg.Wait()
+	// 仅加载一次
+	assert.Equal(int32(1), atomic.LoadInt32(&count))
+
+	// 加载缓慢的key不影响其它key
+	block := make(chan struct{})
+	go func() {
+		_, _ = tc.GetOrLoad(context.Background(), "slow", func(ctx context.Context, key string) (*testData, error) {
+			<-block
+			return &testData{
+				Name: key,
+			}, nil
+		})
+	}()
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		data, err := tc.GetOrLoad(context.Background(), key, func(ctx context.Context, key string) (*testData, error) {
+			return &testData{
+				Name: key,
+			}, nil
+		})
+		assert.Nil(err)
+		assert.Equal(key, data.Name)
+	}
+	// 等待加载的请求可超时
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = tc.GetOrLoad(ctx, "slow", load)
+	assert.Equal(context.DeadlineExceeded, err)
+	close(block)
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// versionUnknown is the version of data written without version,
+// such as the legacy entry
+const versionUnknown uint64 = 1
+
+// 版本号仅用于比较是否修改，无需使用加密安全的随机数
+var versionRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{
+	Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// newVersion returns a random version for writing data,
+// it is greater than versionUnknown
+func newVersion() uint64 {
+	versionRand.Lock()
+	defer versionRand.Unlock()
+	for {
+		version := versionRand.Uint64()
+		if version > versionUnknown {
+			return version
+		}
+	}
+}
+
+// getVersionFromBytes returns the version recorded in the envelope header,
+// touching data will not change its version. The version 0 means the data
+// is not exists, and versionUnknown means the data has no version.
+func getVersionFromBytes(buf []byte) uint64 {
+	if len(buf) <= timestampByteSize {
+		return 0
+	}
+	if len(buf) < envelopeHeaderSize+versionSize ||
+		buf[timestampByteSize] != envelopeMagic ||
+		buf[timestampByteSize+2]&envelopeFlagVersioned == 0 {
+		return versionUnknown
+	}
+	version := buf[timestampByteSize+1]
+	if version != envelopeVersion1 && version != envelopeVersion2 {
+		return versionUnknown
+	}
+	return binary.BigEndian.Uint64(buf[envelopeHeaderSize:])
+}
+
+// formatVersion formats the version as the bytes of envelope header,
+// it is the same as redis lua script
+func formatVersion(version uint64) string {
+	if version == 0 {
+		return ""
+	}
+	buf := make([]byte, versionSize)
+	binary.BigEndian.PutUint64(buf, version)
+	return string(buf)
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdDictIDSize is the size of dictionary id before the compressed data
+const zstdDictIDSize = 4
+
+const defaultZSTDDictMaxSize = 64 * 1024
+
+var ErrZSTDDictIsNil = errors.New("Zstd dictionary is nil")
+var ErrZSTDDictNotFound = errors.New("Zstd dictionary not found")
+
+// ZSTDDictOption is the option of building zstd dictionary
+type ZSTDDictOption struct {
+	// ID is the id of dictionary, a random id will be used if it is 0
+	ID uint32
+	// MaxSize is the max size of dictionary, default is 64KB
+	MaxSize int
+	// Level is the encoder level which the dictionary is tailored for,
+	// the best compression level will be used if it is 0
+	Level int
+}
+
+// BuildZSTDDict builds a zstd dictionary from the samples,
+// the samples can be got by Cache.Sample
+func BuildZSTDDict(samples [][]byte, opt ZSTDDictOption) ([]byte, error) {
+	maxSize := opt.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultZSTDDictMaxSize
+	}
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdDictID:  opt.ID,
+		ZstdLevel:   zstd.EncoderLevel(opt.Level),
+	})
+}
+
+// zstdDictCompressor compresses the data with dictionary,
+// the layout of data: dictionary id(4 bytes) | zstd frame
+type zstdDictCompressor struct {
+	id      uint32
+	ids     map[uint32]bool
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (zc *zstdDictCompressor) encode(data []byte) ([]byte, error) {
+	buf := make([]byte, zstdDictIDSize, zstdDictIDSize+len(data))
+	binary.BigEndian.PutUint32(buf, zc.id)
+	return zc.encoder.EncodeAll(data, buf), nil
+}
+
+func (zc *zstdDictCompressor) decode(data []byte) ([]byte, error) {
+	if len(data) < zstdDictIDSize {
+		return nil, ErrZSTDDictNotFound
+	}
+	// 由其它字典压缩的数据无法解压
+	if !zc.ids[binary.BigEndian.Uint32(data)] {
+		return nil, ErrZSTDDictNotFound
+	}
+	return zc.decoder.DecodeAll(data[zstdDictIDSize:], nil)
+}
+
+// NewZSTDDictCompressor creates a zstd compressor with dictionaries, the first dictionary
+// is used for compression, and all dictionaries are used for decompression by
+// the dictionary id of data. The dictionary can be built by BuildZSTDDict.
+func NewZSTDDictCompressor(minCompressLength, level int, dicts [][]byte, opts ...CompressorAdaptiveOption) (Compressor, error) {
+	if len(dicts) == 0 {
+		return nil, ErrZSTDDictIsNil
+	}
+	ids := make(map[uint32]bool, len(dicts))
+	var id uint32
+	for index, item := range dicts {
+		info, err := zstd.InspectDictionary(item)
+		if err != nil {
+			return nil, err
+		}
+		if index == 0 {
+			id = info.ID()
+		}
+		ids[info.ID()] = true
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)), zstd.WithEncoderDict(dicts[0]))
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		return nil, err
+	}
+	zc := &zstdDictCompressor{
+		id:      id,
+		ids:     ids,
+		encoder: encoder,
+		decoder: decoder,
+	}
+	return newAdaptiveCompressor(CompressorOption{
+		Type:              CompressZSTDDict,
+		MinCompressLength: minCompressLength,
+		Encode:            zc.encode,
+		Decode:            zc.decode,
+	}, opts...), nil
+}
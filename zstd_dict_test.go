@@ -0,0 +1,209 @@
+// Copyright 2022 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDictUser struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+func newTestDictUser(id int) *testDictUser {
+	return &testDictUser{
+		ID:        id,
+		Name:      fmt.Sprintf("user-%d", id),
+		Email:     fmt.Sprintf("user-%d@example.com", id),
+		Role:      []string{"admin", "member", "guest"}[id%3],
+		CreatedAt: time.Unix(int64(1600000000+id), 0).UTC().Format(time.RFC3339),
+		UpdatedAt: time.Unix(int64(1700000000+id), 0).UTC().Format(time.RFC3339),
+	}
+}
+
+func newTestZSTDDict(t *testing.T, id uint32) []byte {
+	assert := assert.New(t)
+	c, err := New(time.Minute)
+	assert.Nil(err)
+	defer c.Close(context.Background())
+	for i := 0; i < 500; i++ {
+		err = c.Set(context.Background(), fmt.Sprintf("user:%d", i), newTestDictUser(i))
+		assert.Nil(err)
+	}
+	samples, err := c.Sample(context.Background(), 300)
+	assert.Nil(err)
+	assert.Equal(300, len(samples))
+
+	zstdDict, err := BuildZSTDDict(samples, ZSTDDictOption{
+		ID:      id,
+		MaxSize: 4 * 1024,
+		Level:   1,
+	})
+	assert.Nil(err)
+	return zstdDict
+}
+
+func TestZSTDDictCompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewZSTDDictCompressor(10, 1, nil)
+	assert.Equal(ErrZSTDDictIsNil, err)
+	_, err = NewZSTDDictCompressor(10, 1, [][]byte{[]byte("invalid dictionary")})
+	assert.NotNil(err)
+
+	dict1 := newTestZSTDDict(t, 1001)
+	dict2 := newTestZSTDDict(t, 1002)
+
+	compressor, err := NewZSTDDictCompressor(10, 1, [][]byte{dict1})
+	assert.Nil(err)
+	data, err := marshal(newTestDictUser(10000))
+	assert.Nil(err)
+
+	buf, err := compressor.Encode(data)
+	assert.Nil(err)
+	assert.Equal(CompressZSTDDict, buf[0])
+	assert.Equal(uint32(1001), binary.BigEndian.Uint32(buf[1:]))
+
+	// 使用字典压缩效果更好
+	zstdBuf, err := NewZSTDCompressor(10, 1).Encode(data)
+	assert.Nil(err)
+	assert.Less(len(buf), len(zstdBuf))
+
+	result, err := compressor.Decode(buf)
+	assert.Nil(err)
+	assert.Equal(data, result)
+
+	// 无对应的字典
+	_, err = decompress(buf)
+	assert.Equal(ErrCompressTypeUnknown, err)
+	otherCompressor, err := NewZSTDDictCompressor(10, 1, [][]byte{dict2})
+	assert.Nil(err)
+	_, err = otherCompressor.Decode(buf)
+	assert.Equal(ErrZSTDDictNotFound, err)
+
+	// 新字典压缩，旧字典用于解压
+	rotatedCompressor, err := NewZSTDDictCompressor(10, 1, [][]byte{dict2, dict1})
+	assert.Nil(err)
+	result, err = rotatedCompressor.Decode(buf)
+	assert.Nil(err)
+	assert.Equal(data, result)
+	buf, err = rotatedCompressor.Encode(data)
+	assert.Nil(err)
+	assert.Equal(uint32(1002), binary.BigEndian.Uint32(buf[1:]))
+	result, err = otherCompressor.Decode(buf)
+	assert.Nil(err)
+	assert.Equal(data, result)
+}
+
+func TestCacheZSTDDict(t *testing.T) {
+	assert := assert.New(t)
+
+	compressor, err := NewZSTDDictCompressor(10, 1, [][]byte{newTestZSTDDict(t, 0)})
+	assert.Nil(err)
+	store, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	dictCache, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+		CacheCompressorOption(compressor),
+	)
+	assert.Nil(err)
+	c, err := New(
+		time.Minute,
+		CacheStoreOption(store),
+	)
+	assert.Nil(err)
+
+	key := randomString()
+	user := newTestDictUser(1)
+	err = dictCache.Set(context.Background(), key, user)
+	assert.Nil(err)
+	result := testDictUser{}
+	err = dictCache.Get(context.Background(), key, &result)
+	assert.Nil(err)
+	assert.Equal(*user, result)
+
+	// 无字典的缓存当作不存在
+	err = c.Get(context.Background(), key, &result)
+	assert.Equal(ErrIsNil, err)
+
+	// 仅嵌入Store接口，不支持Scan
+	c, err = New(
+		time.Minute,
+		CacheStoreOption(struct{ Store }{store}),
+	)
+	assert.Nil(err)
+	_, err = c.Sample(context.Background(), 10)
+	assert.Equal(ErrScanNotSupported, err)
+}
+
+func TestCacheSample(t *testing.T) {
+	assert := assert.New(t)
+
+	s1, err := newBigCacheStore(time.Minute, &Option{})
+	assert.Nil(err)
+	c, err := New(
+		time.Minute,
+		CacheKeyPrefixOption("sample:"+strconv.FormatInt(time.Now().UnixNano(), 10)+":"),
+		CacheStoreOption(s1),
+		CacheSecondaryStoreOption(NewRedisStore(newClient())),
+		CacheChunkSizeOption(16),
+	)
+	assert.Nil(err)
+	ctx := context.Background()
+
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		err = c.SetBytes(ctx, key, []byte("value-"+key))
+		assert.Nil(err)
+		err = s1.Delete(ctx, c.keyPrefix+key)
+		assert.Nil(err)
+	}
+	err = c.SetReader(ctx, "stream", bytes.NewReader([]byte(strings.Repeat("chunk", 10))))
+	assert.Nil(err)
+
+	samples, err := c.Sample(ctx, 100)
+	assert.Nil(err)
+	values := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, string(sample))
+	}
+	// chunk与manifest均不作为样本
+	assert.ElementsMatch([]string{"value-a", "value-b", "value-c"}, values)
+	// 采样的数据不写入一级缓存
+	for _, key := range keys {
+		_, err = s1.Get(ctx, c.keyPrefix+key)
+		assert.Equal(ErrIsNil, err)
+	}
+
+	assert.True(isChunkKey("key:chunk:0123456789abcdef:1"))
+	assert.False(isChunkKey("key:chunk:abc:1"))
+	assert.False(isChunkKey("key:chunk:0123456789abcdef:a"))
+	assert.False(isChunkKey("key"))
+}